@@ -0,0 +1,279 @@
+package conveyor
+
+import (
+	"sort"
+	"sync"
+)
+
+// Number is the constraint of all integer and floating point types.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Ordered is the constraint of all types that support the < operator.
+type Ordered interface {
+	Number | ~string
+}
+
+// The ExtractFunc type is the function called by Aggregator for every line.
+// It passes any number of values of the line to emit.
+type ExtractFunc[T any] func(line []byte, metadata LineMetadata, emit func(T)) error
+
+// Reducer folds values into an accumulator. Init returns an empty accumulator,
+// Add adds value to acc and Merge adds other to acc. Add and Merge return the
+// updated accumulator and may modify acc, but Merge must not modify other.
+type Reducer[T, A any] interface {
+	Init() A
+	Add(acc A, value T) A
+	Merge(acc A, other A) A
+}
+
+// Aggregator is a LineProcessor that folds the values extracted from every line
+// into an accumulator. Every chunk is folded into its own accumulator without
+// locks. The accumulators are merged by Result, the ChunkEndHook discards the
+// accumulator of a failed chunk and the ChunkStartHook the accumulator of the
+// previous attempt of a retried chunk, so their lines are not counted.
+// All lines are dropped from the output, use Tee to keep them.
+//
+// The accumulators are identified by the chunk id, so an Aggregator must not
+// be used by more than one running Queue at the same time. If its hooks are
+// not called, e.g. because it is wrapped by a LineProcessor that does not
+// forward them, the lines of all attempts of all chunks are counted.
+type Aggregator[T, A any] struct {
+	extract ExtractFunc[T]
+	reducer Reducer[T, A]
+
+	// chunks maps the id of every chunk to its *chunkAccumulator.
+	// Every key is written once per attempt and read for every line, which
+	// sync.Map serves without locking.
+	chunks sync.Map
+}
+
+// chunkAccumulator is the accumulator of a single chunk. emit is created
+// once, so it is not allocated for every line.
+type chunkAccumulator[T, A any] struct {
+	acc  A
+	emit func(T)
+}
+
+// NewAggregator returns a new Aggregator that folds the values returned by
+// extract with reducer.
+func NewAggregator[T, A any](extract ExtractFunc[T], reducer Reducer[T, A]) *Aggregator[T, A] {
+	return &Aggregator[T, A]{
+		extract: extract,
+		reducer: reducer,
+	}
+}
+
+// OnChunkStart creates an empty accumulator for chunk, which replaces
+// the accumulator of a previous attempt.
+func (a *Aggregator[T, A]) OnChunkStart(chunk Chunk) error {
+	a.chunks.Store(chunk.Id, a.newChunkAccumulator())
+	return nil
+}
+
+// OnChunkEnd discards the accumulator of the chunk if it failed.
+func (a *Aggregator[T, A]) OnChunkEnd(result ChunkResult) error {
+	if result.Err != nil {
+		a.chunks.Delete(result.Chunk.Id)
+	}
+
+	return nil
+}
+
+// Process adds the values of line to the accumulator of its chunk.
+func (a *Aggregator[T, A]) Process(line []byte, metadata LineMetadata) ([]byte, error) {
+	value, ok := a.chunks.Load(metadata.Chunk.Id)
+	if !ok {
+		value, _ = a.chunks.LoadOrStore(metadata.Chunk.Id, a.newChunkAccumulator())
+	}
+
+	return nil, a.extract(line, metadata, value.(*chunkAccumulator[T, A]).emit)
+}
+
+func (a *Aggregator[T, A]) newChunkAccumulator() *chunkAccumulator[T, A] {
+	local := &chunkAccumulator[T, A]{acc: a.reducer.Init()}
+	local.emit = func(value T) {
+		local.acc = a.reducer.Add(local.acc, value)
+	}
+
+	return local
+}
+
+// Result returns the merged accumulators of all succeeded chunks. It must
+// not be called while the Queue is running.
+func (a *Aggregator[T, A]) Result() A {
+	acc := a.reducer.Init()
+
+	a.chunks.Range(func(_, value interface{}) bool {
+		acc = a.reducer.Merge(acc, value.(*chunkAccumulator[T, A]).acc)
+		return true
+	})
+
+	return acc
+}
+
+// Reset discards the accumulators of all chunks, so the Aggregator can be
+// used for another run. It must not be called while the Queue is running.
+func (a *Aggregator[T, A]) Reset() {
+	a.chunks.Range(func(key, _ interface{}) bool {
+		a.chunks.Delete(key)
+		return true
+	})
+}
+
+// CountReducer returns a Reducer that counts the values.
+func CountReducer[T any]() Reducer[T, int64] {
+	return countReducer[T]{}
+}
+
+type countReducer[T any] struct{}
+
+func (countReducer[T]) Init() int64                  { return 0 }
+func (countReducer[T]) Add(acc int64, _ T) int64     { return acc + 1 }
+func (countReducer[T]) Merge(acc, other int64) int64 { return acc + other }
+
+// SumReducer returns a Reducer that sums up the values.
+func SumReducer[N Number]() Reducer[N, N] {
+	return sumReducer[N]{}
+}
+
+type sumReducer[N Number] struct{}
+
+func (sumReducer[N]) Init() N              { return 0 }
+func (sumReducer[N]) Add(acc N, value N) N { return acc + value }
+func (sumReducer[N]) Merge(acc, other N) N { return acc + other }
+
+// Extremum is the accumulator of MinReducer and MaxReducer. Ok is false
+// if there were no values.
+type Extremum[N Ordered] struct {
+	Value N
+	Ok    bool
+}
+
+// MinReducer returns a Reducer that keeps the smallest value.
+func MinReducer[N Ordered]() Reducer[N, Extremum[N]] {
+	return extremumReducer[N]{better: func(a, b N) bool { return a < b }}
+}
+
+// MaxReducer returns a Reducer that keeps the largest value.
+func MaxReducer[N Ordered]() Reducer[N, Extremum[N]] {
+	return extremumReducer[N]{better: func(a, b N) bool { return a > b }}
+}
+
+type extremumReducer[N Ordered] struct {
+	better func(a, b N) bool
+}
+
+func (extremumReducer[N]) Init() Extremum[N] {
+	return Extremum[N]{}
+}
+
+func (e extremumReducer[N]) Add(acc Extremum[N], value N) Extremum[N] {
+	if !acc.Ok || e.better(value, acc.Value) {
+		return Extremum[N]{Value: value, Ok: true}
+	}
+
+	return acc
+}
+
+func (e extremumReducer[N]) Merge(acc, other Extremum[N]) Extremum[N] {
+	if !other.Ok {
+		return acc
+	}
+
+	return e.Add(acc, other.Value)
+}
+
+// Histogram is the accumulator of HistogramReducer. It maps every
+// value to the number of its occurrences.
+type Histogram[K comparable] map[K]int64
+
+// Bucket is a single value of a Histogram with its count.
+type Bucket[K comparable] struct {
+	Value K
+	Count int64
+}
+
+// Top returns the k most frequent values of the Histogram, ordered by their
+// count in descending order. Values with the same count are in no particular order.
+func (h Histogram[K]) Top(k int) []Bucket[K] {
+	buckets := make([]Bucket[K], 0, len(h))
+	for value, count := range h {
+		buckets = append(buckets, Bucket[K]{Value: value, Count: count})
+	}
+
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Count > buckets[j].Count
+	})
+
+	if k < len(buckets) {
+		buckets = buckets[:k]
+	}
+
+	return buckets
+}
+
+// HistogramReducer returns a Reducer that counts the occurrences of every value.
+func HistogramReducer[K comparable]() Reducer[K, Histogram[K]] {
+	return histogramReducer[K]{}
+}
+
+type histogramReducer[K comparable] struct{}
+
+func (histogramReducer[K]) Init() Histogram[K] {
+	return make(Histogram[K])
+}
+
+func (histogramReducer[K]) Add(acc Histogram[K], value K) Histogram[K] {
+	acc[value]++
+	return acc
+}
+
+func (histogramReducer[K]) Merge(acc, other Histogram[K]) Histogram[K] {
+	for value, count := range other {
+		acc[value] += count
+	}
+
+	return acc
+}
+
+// TopKReducer returns a Reducer that keeps the k largest values in descending
+// order. For the most frequent values use HistogramReducer and Histogram.Top.
+func TopKReducer[N Ordered](k int) Reducer[N, []N] {
+	return topKReducer[N]{k: k}
+}
+
+type topKReducer[N Ordered] struct {
+	k int
+}
+
+func (t topKReducer[N]) Init() []N {
+	return make([]N, 0, t.k)
+}
+
+func (t topKReducer[N]) Add(acc []N, value N) []N {
+	i := sort.Search(len(acc), func(i int) bool { return acc[i] < value })
+	if i >= t.k {
+		return acc
+	}
+
+	if len(acc) < t.k {
+		acc = append(acc, value)
+	}
+
+	copy(acc[i+1:], acc[i:])
+	acc[i] = value
+
+	return acc
+}
+
+func (t topKReducer[N]) Merge(acc, other []N) []N {
+	for _, value := range other {
+		acc = t.Add(acc, value)
+	}
+
+	return acc
+}
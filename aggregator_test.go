@@ -0,0 +1,226 @@
+package conveyor_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/fgehrlicher/conveyor"
+	"github.com/stretchr/testify/assert"
+)
+
+func extractNumber(line []byte, _ conveyor.LineMetadata, emit func(int)) error {
+	number, err := strconv.Atoi(string(bytes.TrimSpace(line)))
+	if err != nil {
+		return err
+	}
+
+	emit(number)
+	return nil
+}
+
+// aggregate runs a Queue with 4 workers and aggregator on testFile.
+func aggregate(t *testing.T, testFile string, aggregator conveyor.LineProcessor) conveyor.QueueResult {
+	chunks, err := conveyor.GetChunksFromFile(testFile, 64, nil)
+	assert.NoError(t, err)
+
+	return conveyor.NewQueue(chunks, 4, aggregator, &conveyor.QueueOpts{
+		Logger:    NullLogger(),
+		ErrLogger: NullLogger(),
+	}).Work()
+}
+
+func TestAggregatorReducers(t *testing.T) {
+	var (
+		assertion = assert.New(t)
+		lines     = 1000
+	)
+
+	testFile, _ := writeLinesTestFile(t, lines, "\n", strconv.Itoa)
+
+	count := conveyor.NewAggregator(extractNumber, conveyor.CountReducer[int]())
+	sum := conveyor.NewAggregator(extractNumber, conveyor.SumReducer[int]())
+	min := conveyor.NewAggregator(extractNumber, conveyor.MinReducer[int]())
+	max := conveyor.NewAggregator(extractNumber, conveyor.MaxReducer[int]())
+	topK := conveyor.NewAggregator(extractNumber, conveyor.TopKReducer[int](3))
+	lastDigits := conveyor.NewAggregator(func(line []byte, metadata conveyor.LineMetadata, emit func(int)) error {
+		return extractNumber(line, metadata, func(number int) { emit(number % 10) })
+	}, conveyor.HistogramReducer[int]())
+
+	for _, aggregator := range []conveyor.LineProcessor{count, sum, min, max, topK, lastDigits} {
+		result := aggregate(t, testFile, aggregator)
+		assertion.Empty(result.FailedChunks)
+		assertion.Equal(int64(lines), result.Lines)
+	}
+
+	assertion.Equal(int64(lines), count.Result())
+	assertion.Equal(lines*(lines+1)/2, sum.Result())
+	assertion.Equal(conveyor.Extremum[int]{Value: 1, Ok: true}, min.Result())
+	assertion.Equal(conveyor.Extremum[int]{Value: lines, Ok: true}, max.Result())
+	assertion.Equal([]int{1000, 999, 998}, topK.Result())
+
+	histogram := lastDigits.Result()
+	assertion.Len(histogram, 10)
+	for digit := 0; digit < 10; digit++ {
+		assertion.Equal(int64(lines/10), histogram[digit])
+	}
+
+	count.Reset()
+	assertion.Equal(int64(0), count.Result())
+	assertion.Equal(conveyor.Extremum[int]{}, conveyor.NewAggregator(extractNumber, conveyor.MinReducer[int]()).Result())
+}
+
+func TestAggregatorExtractError(t *testing.T) {
+	var (
+		assertion = assert.New(t)
+		testFile  = filepath.Join(t.TempDir(), "numbers.txt")
+	)
+
+	assertion.NoError(ioutil.WriteFile(testFile, []byte("1\n2\nthree\n4\n"), 0644))
+
+	sum := conveyor.NewAggregator(extractNumber, conveyor.SumReducer[int]())
+	chunks, err := conveyor.GetChunksFromFile(testFile, 64, nil)
+	assertion.NoError(err)
+
+	result := conveyor.NewQueue(chunks, 1, sum, &conveyor.QueueOpts{
+		Logger:          NullLogger(),
+		ErrLogger:       NullLogger(),
+		LineErrorPolicy: conveyor.SkipLine,
+	}).Work()
+
+	assertion.Empty(result.FailedChunks)
+	assertion.Equal(7, sum.Result())
+	assertion.Len(result.Results, 1)
+	assertion.Len(result.Results[0].LineErrors, 1)
+	assertion.True(errors.Is(result.Results[0].LineErrors[0], strconv.ErrSyntax))
+}
+
+func TestAggregatorCountsSucceededChunksOnly(t *testing.T) {
+	var (
+		assertion = assert.New(t)
+		lines     = 100
+	)
+
+	testFile, _ := writeLinesTestFile(t, lines, "\n", strconv.Itoa)
+
+	for _, maxAttempts := range []int{1, 2} {
+		count := conveyor.NewAggregator(extractNumber, conveyor.CountReducer[int]())
+
+		chunks, err := conveyor.GetChunksFromFile(testFile, 64, nil)
+		assertion.NoError(err)
+
+		result := conveyor.NewQueue(chunks, 4, conveyor.Chain(newFlakyProcessor(1, 2), conveyor.Tee(count)), &conveyor.QueueOpts{
+			Logger:      NullLogger(),
+			ErrLogger:   NullLogger(),
+			RetryPolicy: &conveyor.RetryPolicy{MaxAttempts: maxAttempts},
+		}).Work()
+
+		var succeededLines int64
+		for _, chunkResult := range result.Results {
+			if chunkResult.Ok() {
+				succeededLines += int64(chunkResult.Lines)
+			}
+		}
+
+		if maxAttempts == 1 {
+			assertion.Equal(1, result.FailedChunks)
+			assertion.Less(succeededLines, int64(lines))
+		} else {
+			assertion.Empty(result.FailedChunks)
+			assertion.Equal(int64(lines), succeededLines)
+		}
+
+		assertion.Equal(succeededLines, count.Result())
+	}
+}
+
+func TestAggregatorWithoutHooks(t *testing.T) {
+	var (
+		assertion = assert.New(t)
+		lines     = 100
+	)
+
+	testFile, _ := writeLinesTestFile(t, lines, "\n", strconv.Itoa)
+
+	count := conveyor.NewAggregator(extractNumber, conveyor.CountReducer[int]())
+	result := aggregate(t, testFile, conveyor.LineProcessorFunc(count.Process))
+
+	assertion.NoError(result.Err)
+	assertion.Equal(int64(lines), count.Result())
+}
+
+// failingOnceWriter fails the first write of the chunk with the given id.
+type failingOnceWriter struct {
+	sync.Mutex
+	chunkId int
+	failed  bool
+}
+
+func (f *failingOnceWriter) Write(chunk *conveyor.Chunk, buff []byte) error {
+	f.Lock()
+	defer f.Unlock()
+
+	if chunk.Id == f.chunkId && !f.failed {
+		f.failed = true
+		return errTransient
+	}
+
+	return nil
+}
+
+func TestAggregatorCountsRetriedWriteOnce(t *testing.T) {
+	var (
+		assertion = assert.New(t)
+		lines     = 100
+	)
+
+	testFile, _ := writeLinesTestFile(t, lines, "\n", strconv.Itoa)
+
+	count := conveyor.NewAggregator(extractNumber, conveyor.CountReducer[int]())
+
+	chunks, err := conveyor.GetChunksFromFile(testFile, 64, &failingOnceWriter{chunkId: 2})
+	assertion.NoError(err)
+
+	result := conveyor.NewQueue(chunks, 4, conveyor.Tee(count), &conveyor.QueueOpts{
+		Logger:      NullLogger(),
+		ErrLogger:   NullLogger(),
+		RetryPolicy: &conveyor.RetryPolicy{MaxAttempts: 2},
+	}).Work()
+
+	assertion.NoError(result.Err)
+	assertion.Empty(result.FailedChunks)
+	assertion.Equal(int64(lines), count.Result())
+}
+
+func TestHistogramTop(t *testing.T) {
+	assertion := assert.New(t)
+
+	histogram := conveyor.Histogram[string]{"a": 3, "b": 7, "c": 1, "d": 5}
+
+	assertion.Equal([]conveyor.Bucket[string]{{Value: "b", Count: 7}, {Value: "d", Count: 5}}, histogram.Top(2))
+	assertion.Len(histogram.Top(10), 4)
+	assertion.Empty(conveyor.Histogram[string]{}.Top(3))
+}
+
+func TestTopKReducer(t *testing.T) {
+	assertion := assert.New(t)
+	reducer := conveyor.TopKReducer[string](3)
+
+	first, second := reducer.Init(), reducer.Init()
+	for _, value := range []string{"d", "a", "f"} {
+		first = reducer.Add(first, value)
+	}
+
+	for _, value := range []string{"b", "e", "c", "g"} {
+		second = reducer.Add(second, value)
+	}
+
+	assertion.Equal([]string{"f", "d", "a"}, first)
+	assertion.Equal([]string{"g", "e", "c"}, second)
+	assertion.Equal([]string{"g", "f", "e"}, reducer.Merge(first, second))
+	assertion.Equal([]string{"g", "e", "c"}, second)
+}
@@ -0,0 +1,295 @@
+package conveyor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ErrWriterNotResumed is returned if a ChunkWriter that keeps the order
+// does not continue after the last contiguous chunk of the Checkpoint.
+var ErrWriterNotResumed = errors.New("writer not resumed from checkpoint")
+
+// CheckpointEntry is the persisted metadata of a completed chunk.
+type CheckpointEntry struct {
+	ChunkId    int   `json:"chunk_id"`
+	Offset     int64 `json:"offset"`
+	Size       int   `json:"size"`
+	RealOffset int64 `json:"real_offset"`
+	RealSize   int   `json:"real_size"`
+	Lines      int   `json:"lines"`
+	OutSize    int   `json:"out_size"`
+	EOF        bool  `json:"eof,omitempty"`
+}
+
+// Checkpoint is a file based store of completed chunks. Every completed chunk is
+// appended as json line to the checkpoint file, so a killed run can be resumed
+// by passing the same checkpoint file via QueueOpts.Checkpoint.
+// A resumed run must use the same chunks as the interrupted run.
+type Checkpoint struct {
+	file    *os.File
+	entries map[int]CheckpointEntry
+
+	sync.Mutex
+}
+
+// OpenCheckpoint opens or creates the checkpoint file at path and loads all
+// entries. A partially written last entry is discarded.
+func OpenCheckpoint(path string) (*Checkpoint, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint := &Checkpoint{
+		file:    file,
+		entries: make(map[int]CheckpointEntry),
+	}
+
+	if err = checkpoint.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return checkpoint, nil
+}
+
+// load reads all complete entries and truncates the file after the last one.
+func (c *Checkpoint) load() error {
+	var (
+		reader    = bufio.NewReader(c.file)
+		validSize int64
+	)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var entry CheckpointEntry
+		if err = json.Unmarshal(bytes.TrimSpace(line), &entry); err != nil {
+			break
+		}
+
+		c.entries[entry.ChunkId] = entry
+		validSize += int64(len(line))
+	}
+
+	if err := c.file.Truncate(validSize); err != nil {
+		return err
+	}
+
+	_, err := c.file.Seek(validSize, io.SeekStart)
+	return err
+}
+
+// Done checks if the chunk with the given id is marked as completed.
+func (c *Checkpoint) Done(chunkId int) bool {
+	_, ok := c.Entry(chunkId)
+	return ok
+}
+
+// Entry returns the CheckpointEntry for the given chunk id.
+func (c *Checkpoint) Entry(chunkId int) (CheckpointEntry, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	entry, ok := c.entries[chunkId]
+	return entry, ok
+}
+
+// Record marks the chunk of result as completed and persists its metadata.
+func (c *Checkpoint) Record(result ChunkResult) error {
+	entry := CheckpointEntry{
+		ChunkId:    result.Chunk.Id,
+		Offset:     result.Chunk.Offset,
+		Size:       result.Chunk.Size,
+		RealOffset: result.RealOffset,
+		RealSize:   result.RealSize,
+		Lines:      result.Lines,
+		OutSize:    result.OutSize,
+		EOF:        result.EOF,
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if _, err = c.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	if err = c.file.Sync(); err != nil {
+		return err
+	}
+
+	c.entries[entry.ChunkId] = entry
+	return nil
+}
+
+// Close closes the underlying checkpoint file.
+func (c *Checkpoint) Close() error {
+	return c.file.Close()
+}
+
+// lastContiguous returns the highest chunk id for which all chunks
+// from 1 up to this id are completed.
+func (c *Checkpoint) lastContiguous() int {
+	c.Lock()
+	defer c.Unlock()
+
+	id := 0
+	for {
+		if _, ok := c.entries[id+1]; !ok {
+			return id
+		}
+		id++
+	}
+}
+
+// resumableWriter is implemented by ChunkWriters that keep the order and
+// can continue an interrupted run, see ConcurrentWriter.Resume.
+type resumableWriter interface {
+	// lastChunk returns the id of the last chunk that was written.
+	lastChunk() int
+	// continueAfter continues writing after the chunk with the given id.
+	continueAfter(chunkId int)
+}
+
+// checkWriters checks that every ChunkWriter of chunks that keeps the order
+// continues after the last contiguous chunk. Such a writer only writes a
+// chunk after all chunks before it, so it would wait forever for the
+// restored chunks otherwise. Dead letter writers that were not written yet
+// are advanced to the last contiguous chunk, since the dead letters of the
+// restored chunks were written by the interrupted run.
+func (c *Checkpoint) checkWriters(chunks []Chunk, opts *QueueOpts) error {
+	lastContiguous := c.lastContiguous()
+
+	for i := range chunks {
+		if err := checkWriter(chunks[i].Out, lastContiguous, false); err != nil {
+			return err
+		}
+
+		deadLetter := deadLetterWriter(&chunks[i], opts)
+		if err := checkWriter(deadLetter, lastContiguous, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkWriter checks that out continues after lastContiguous if it keeps
+// the order. If advance is set, a writer that was not written yet is
+// advanced to lastContiguous.
+func checkWriter(out ChunkWriter, lastContiguous int, advance bool) error {
+	if !keepsOrder(out) {
+		return nil
+	}
+
+	resumable, ok := out.(resumableWriter)
+	if !ok {
+		return fmt.Errorf("%w: %T", ErrResumeNotSupported, out)
+	}
+
+	last := resumable.lastChunk()
+	if advance && last == 0 {
+		resumable.continueAfter(lastContiguous)
+		return nil
+	}
+
+	if last != lastContiguous {
+		return fmt.Errorf(
+			"%w: writer continues after chunk %d, checkpoint after chunk %d",
+			ErrWriterNotResumed,
+			last,
+			lastContiguous,
+		)
+	}
+
+	return nil
+}
+
+// keepsChunkOrder checks if the output or the dead letters of chunk are
+// written by a ChunkWriter that keeps the order.
+func keepsChunkOrder(chunk *Chunk, opts *QueueOpts) bool {
+	return keepsOrder(chunk.Out) || keepsOrder(deadLetterWriter(chunk, opts))
+}
+
+// restore returns the ChunkResult for chunk if it was completed in a
+// previous run. Chunks written by an ordered writer are only restored if all
+// chunks before them are completed, since only those are flushed.
+func (c *Checkpoint) restore(chunk Chunk, opts *QueueOpts) (ChunkResult, bool) {
+	entry, ok := c.Entry(chunk.Id)
+	if !ok || entry.Offset != chunk.Offset || entry.Size != chunk.Size {
+		return ChunkResult{}, false
+	}
+
+	if keepsChunkOrder(&chunk, opts) && chunk.Id > c.lastContiguous() {
+		return ChunkResult{}, false
+	}
+
+	return ChunkResult{
+		Chunk:      chunk,
+		RealOffset: entry.RealOffset,
+		RealSize:   entry.RealSize,
+		Lines:      entry.Lines,
+		OutSize:    entry.OutSize,
+		EOF:        entry.EOF,
+		Restored:   true,
+	}, true
+}
+
+// checkpointRecorder records completed chunks to a Checkpoint. Results of
+// chunks written by an ordered writer are held back until all chunks before
+// them are completed, so only chunks that are actually flushed are recorded.
+type checkpointRecorder struct {
+	checkpoint *Checkpoint
+	opts       *QueueOpts
+	pending    map[int]ChunkResult
+	next       int
+}
+
+func newCheckpointRecorder(checkpoint *Checkpoint, opts *QueueOpts) *checkpointRecorder {
+	return &checkpointRecorder{
+		checkpoint: checkpoint,
+		opts:       opts,
+		pending:    make(map[int]ChunkResult),
+		next:       checkpoint.lastContiguous() + 1,
+	}
+}
+
+func (r *checkpointRecorder) record(result ChunkResult) error {
+	if !keepsChunkOrder(&result.Chunk, r.opts) {
+		return r.checkpoint.Record(result)
+	}
+
+	r.pending[result.Chunk.Id] = result
+
+	for {
+		pending, ok := r.pending[r.next]
+		if !ok {
+			return nil
+		}
+
+		if err := r.checkpoint.Record(pending); err != nil {
+			return err
+		}
+
+		delete(r.pending, r.next)
+		r.next++
+	}
+}
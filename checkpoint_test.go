@@ -0,0 +1,238 @@
+package conveyor_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fgehrlicher/conveyor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpointDiscardsPartialEntry(t *testing.T) {
+	assertion := assert.New(t)
+	path := filepath.Join(t.TempDir(), "checkpoint")
+
+	err := ioutil.WriteFile(
+		path,
+		[]byte("{\"chunk_id\":1,\"offset\":0,\"size\":100}\n{\"chunk_id\":2,\"off"),
+		0644,
+	)
+	assertion.NoError(err)
+
+	checkpoint, err := conveyor.OpenCheckpoint(path)
+	assertion.NoError(err)
+
+	assertion.True(checkpoint.Done(1))
+	assertion.False(checkpoint.Done(2))
+
+	assertion.NoError(checkpoint.Record(conveyor.ChunkResult{Chunk: conveyor.Chunk{Id: 2}, Lines: 5}))
+	assertion.NoError(checkpoint.Close())
+
+	checkpoint, err = conveyor.OpenCheckpoint(path)
+	assertion.NoError(err)
+	defer checkpoint.Close()
+
+	entry, ok := checkpoint.Entry(2)
+	assertion.True(ok)
+	assertion.Equal(5, entry.Lines)
+}
+
+func TestQueueResumesFromCheckpoint(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		testQueueResumesFromCheckpoint(t, workers)
+	}
+}
+
+func testQueueResumesFromCheckpoint(t *testing.T, workers int) {
+	var (
+		assertion      = assert.New(t)
+		testFile       = "testdata/data.txt"
+		testResultFile = "testdata/converted_data.txt"
+		dir            = t.TempDir()
+		checkpointPath = filepath.Join(dir, "checkpoint")
+		outPath        = filepath.Join(dir, "out.txt")
+		cancelAt       = 6
+	)
+
+	run := func(ctx context.Context, cancel context.CancelFunc) conveyor.QueueResult {
+		checkpoint, err := conveyor.OpenCheckpoint(checkpointPath)
+		assertion.NoError(err)
+		defer checkpoint.Close()
+
+		out, err := os.OpenFile(outPath, os.O_RDWR|os.O_CREATE, 0644)
+		assertion.NoError(err)
+		defer out.Close()
+
+		writer := conveyor.NewConcurrentWriter(out, true)
+		assertion.NoError(writer.Resume(checkpoint))
+
+		chunks, err := conveyor.GetChunksFromFile(testFile, 512, writer)
+		assertion.NoError(err)
+
+		return conveyor.NewQueue(
+			chunks,
+			workers,
+			conveyor.LineProcessorFunc(func(line []byte, metadata conveyor.LineMetadata) ([]byte, error) {
+				if cancel != nil && metadata.Chunk.Id == cancelAt {
+					cancel()
+				}
+
+				return Redact(line, metadata)
+			}),
+			&conveyor.QueueOpts{
+				Logger:     NullLogger(),
+				ErrLogger:  NullLogger(),
+				Checkpoint: checkpoint,
+			},
+		).WorkContext(ctx)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	interrupted := run(ctx, cancel)
+	assertion.ErrorIs(interrupted.Err, context.Canceled)
+	assertion.NotEmpty(interrupted.UnprocessedChunks)
+
+	resumed := run(context.Background(), nil)
+	assertion.NoError(resumed.Err)
+	assertion.Empty(resumed.FailedChunks)
+	assertion.Empty(resumed.UnprocessedChunks)
+	assertion.Equal(int64(100), resumed.Lines)
+
+	if workers == 1 {
+		var restored int
+		for _, result := range resumed.Results {
+			if result.Restored {
+				restored++
+			}
+		}
+		assertion.Equal(cancelAt-1, restored)
+	}
+
+	expectedFile, err := ioutil.ReadFile(testResultFile)
+	assertion.NoError(err)
+
+	actualFile, err := ioutil.ReadFile(outPath)
+	assertion.NoError(err)
+
+	assertion.Equal(string(expectedFile), string(actualFile))
+}
+
+func TestQueueRejectsWriterNotResumedFromCheckpoint(t *testing.T) {
+	var (
+		assertion      = assert.New(t)
+		testFile       = "testdata/data.txt"
+		checkpointPath = filepath.Join(t.TempDir(), "checkpoint")
+	)
+
+	checkpoint, err := conveyor.OpenCheckpoint(checkpointPath)
+	assertion.NoError(err)
+	defer checkpoint.Close()
+
+	chunks, err := conveyor.GetChunksFromFile(testFile, 512, nil)
+	assertion.NoError(err)
+	assertion.NoError(checkpoint.Record(conveyor.ChunkResult{Chunk: chunks[0], OutSize: 10}))
+
+	compressingWriter, err := conveyor.NewCompressingWriter(ioutil.Discard, true, conveyor.Gzip)
+	assertion.NoError(err)
+	defer compressingWriter.Close()
+
+	for _, testCase := range []struct {
+		writer conveyor.ChunkWriter
+		err    error
+	}{
+		{conveyor.NewConcurrentWriter(ioutil.Discard, true), conveyor.ErrWriterNotResumed},
+		{compressingWriter, conveyor.ErrResumeNotSupported},
+	} {
+		chunks, err := conveyor.GetChunksFromFile(testFile, 512, testCase.writer)
+		assertion.NoError(err)
+
+		result := conveyor.NewQueue(chunks, 2, NullLineProcessor, &conveyor.QueueOpts{
+			Logger:     NullLogger(),
+			ErrLogger:  NullLogger(),
+			Checkpoint: checkpoint,
+		}).Work()
+
+		assertion.ErrorIs(result.Err, testCase.err)
+		assertion.Equal(len(chunks), result.UnprocessedChunks)
+		assertion.Zero(result.Lines)
+	}
+}
+
+func TestQueueResumesDeadLettersFromCheckpoint(t *testing.T) {
+	var (
+		assertion       = assert.New(t)
+		testFile        = "testdata/data.txt"
+		dir             = t.TempDir()
+		checkpointPath  = filepath.Join(dir, "checkpoint")
+		deadLettersPath = filepath.Join(dir, "dead_letters.txt")
+		cancelAt        = 6
+	)
+
+	run := func(ctx context.Context, cancel context.CancelFunc, deadLetters io.Writer, checkpoint *conveyor.Checkpoint) conveyor.QueueResult {
+		chunks, err := conveyor.GetChunksFromFile(testFile, 512, conveyor.NewConcurrentWriter(ioutil.Discard, false))
+		assertion.NoError(err)
+
+		return conveyor.NewQueue(
+			chunks,
+			1,
+			conveyor.LineProcessorFunc(func(line []byte, metadata conveyor.LineMetadata) ([]byte, error) {
+				if cancel != nil && metadata.Chunk.Id == cancelAt {
+					cancel()
+				}
+
+				if bytes.Contains(line, []byte("Lorem")) {
+					return nil, errors.New("contains lorem")
+				}
+
+				return line, nil
+			}),
+			&conveyor.QueueOpts{
+				Logger:          NullLogger(),
+				ErrLogger:       NullLogger(),
+				LineErrorPolicy: conveyor.SkipLine,
+				DeadLetter:      conveyor.NewConcurrentWriter(deadLetters, true),
+				Checkpoint:      checkpoint,
+			},
+		).WorkContext(ctx)
+	}
+
+	runWithCheckpoint := func(ctx context.Context, cancel context.CancelFunc) conveyor.QueueResult {
+		checkpoint, err := conveyor.OpenCheckpoint(checkpointPath)
+		assertion.NoError(err)
+		defer checkpoint.Close()
+
+		deadLetters, err := os.OpenFile(deadLettersPath, os.O_RDWR|os.O_CREATE, 0644)
+		assertion.NoError(err)
+		defer deadLetters.Close()
+
+		return run(ctx, cancel, deadLetters, checkpoint)
+	}
+
+	expected := &bytes.Buffer{}
+	uninterrupted := run(context.Background(), nil, expected, nil)
+	assertion.NoError(uninterrupted.Err)
+	assertion.NotEmpty(expected.Len())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	interrupted := runWithCheckpoint(ctx, cancel)
+	assertion.ErrorIs(interrupted.Err, context.Canceled)
+
+	resumed := runWithCheckpoint(context.Background(), nil)
+	assertion.NoError(resumed.Err)
+	assertion.Empty(resumed.UnprocessedChunks)
+
+	actual, err := ioutil.ReadFile(deadLettersPath)
+	assertion.NoError(err)
+
+	assertion.Equal(expected.String(), string(actual))
+}
@@ -1,16 +1,30 @@
 package conveyor
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"os"
 )
 
+// ErrChunkNotProcessed is set as ChunkResult.Err for chunks which were
+// not (or not completely) processed because the Queue run was canceled.
+var ErrChunkNotProcessed = errors.New("chunk not processed")
+
 // ChunkWriter is the interface that wraps the basic Write method.
 // Write writes len(buff) bytes from buff to the underlying data stream.
+// It is called once for every successfully processed chunk, even if buff is empty.
 type ChunkWriter interface {
 	Write(chunk *Chunk, buff []byte) error
 }
 
+// OrderedChunkWriter is implemented by ChunkWriters that write the chunks
+// in the order of their ids, starting with id 1.
+type OrderedChunkWriter interface {
+	ChunkWriter
+	KeepsOrder() bool
+}
+
 // ChunkReader is the interface that wraps OpenHandle and GetHandleID.
 // OpenHandle opens a resource and returns a io.ReadSeekCloser
 // GetHandleID returns the name / id of the underlying resource. This string is used for
@@ -28,6 +42,35 @@ type Chunk struct {
 
 	In  ChunkReader
 	Out ChunkWriter
+
+	// DeadLetter overrides QueueOpts.DeadLetter for this chunk.
+	DeadLetter ChunkWriter
+
+	// InQuotes is set if Offset is inside a quoted field. It is only used
+	// if the Delimiter has a Quote, see ScanQuotes.
+	InQuotes bool
+
+	// StartLine is the number of the first line of the chunk inside its
+	// ChunkReader, starting at 1. It is 0 if the line numbers are unknown,
+	// see NumberLines.
+	StartLine int64
+
+	// Aligned is set for chunks that start at the start of a line and end
+	// at the end of a line, see LineIndex.Chunks. The Worker does not search
+	// the line boundaries of aligned chunks and their Size may differ from the
+	// chunk size of the Queue.
+	Aligned bool
+
+	// ExpectedLines is the number of lines of the chunk if it is known, e.g.
+	// for chunks of GetLineChunksFromFile. The chunk fails with
+	// ErrUnexpectedLineCount if it has a different number of lines.
+	// 0 disables the check.
+	ExpectedLines int
+
+	// attempts is the number of failed attempts of a retried chunk.
+	attempts int
+	// eof is set by the Worker if the chunk ended at the end of its input.
+	eof bool
 }
 
 // ChunkResult is the type returned after processing a chunk.
@@ -40,6 +83,25 @@ type ChunkResult struct {
 	RealOffset int64
 	Lines      int
 	EOF        bool
+
+	// OutSize is the number of bytes passed to the ChunkWriter.
+	OutSize int
+	// Restored is set for results restored from QueueOpts.Checkpoint.
+	// Those chunks were completed in a previous run and not processed again.
+	Restored bool
+
+	// LineErrors contains the errors of all lines that were skipped or
+	// replaced because of the LineErrorPolicy.
+	LineErrors []*LineError
+
+	// Attempts is the number of times the chunk was processed,
+	// which is more than one if it was retried, see RetryPolicy.
+	Attempts int
+
+	// deadLetters are the dead letters of an attempt that may be retried,
+	// they are only written if the attempt is the final result.
+	deadLetters      []byte
+	holdsDeadLetters bool
 }
 
 // Ok checks if the chunk was processed successfully.
@@ -47,6 +109,23 @@ func (c *ChunkResult) Ok() bool {
 	return c.Err == nil
 }
 
+// Processed checks if the chunk was processed at all.
+// It returns false for chunks that were left over or aborted after the
+// Queue run was canceled.
+func (c *ChunkResult) Processed() bool {
+	return !errors.Is(c.Err, ErrChunkNotProcessed)
+}
+
+// keepsOrder checks if out is an OrderedChunkWriter that keeps the order.
+func keepsOrder(out ChunkWriter) bool {
+	ordered, ok := out.(OrderedChunkWriter)
+	return ok && ordered.KeepsOrder()
+}
+
+func notProcessedErr(cause error) error {
+	return fmt.Errorf("%w: %s", ErrChunkNotProcessed, cause)
+}
+
 // GetChunksFromFile generates a slice of Chunk for a given file path and ChunkWriter
 func GetChunksFromFile(filePath string, chunkSize int, out ChunkWriter) ([]Chunk, error) {
 	info, err := os.Stat(filePath)
@@ -54,24 +133,50 @@ func GetChunksFromFile(filePath string, chunkSize int, out ChunkWriter) ([]Chunk
 		return nil, err
 	}
 
+	return getChunks(&FileReader{FilePath: filePath}, info.Size(), chunkSize, 1, out), nil
+}
+
+// GetChunksFromReader generates a slice of Chunk for a given ChunkReader and ChunkWriter.
+// The size of the resource is determined by seeking to its end.
+func GetChunksFromReader(in ChunkReader, chunkSize int, out ChunkWriter) ([]Chunk, error) {
+	return getChunksFromReader(in, chunkSize, 1, out)
+}
+
+func getChunksFromReader(in ChunkReader, chunkSize int, firstId int, out ChunkWriter) ([]Chunk, error) {
+	handle, err := in.OpenHandle()
+	if err != nil {
+		return nil, err
+	}
+	defer handle.Close()
+
+	size, err := handle.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	return getChunks(in, size, chunkSize, firstId, out), nil
+}
+
+// getChunks splits a resource of the given size into chunks. The chunk ids start at firstId.
+func getChunks(in ChunkReader, size int64, chunkSize int, firstId int, out ChunkWriter) []Chunk {
 	var (
 		currentOffset int64 = 0
-		currentChunk        = 1
+		currentChunk        = firstId
 		chunks        []Chunk
 	)
 
-	for currentOffset <= info.Size() {
+	for currentOffset < size {
 		chunks = append(chunks, Chunk{
 			Id:     currentChunk,
 			Offset: currentOffset,
 			Size:   chunkSize,
 			Out:    out,
-			In:     &FileReader{FilePath: filePath},
+			In:     in,
 		})
 
 		currentOffset += int64(chunkSize)
 		currentChunk++
 	}
 
-	return chunks, err
+	return chunks
 }
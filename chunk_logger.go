@@ -11,7 +11,8 @@ var DefaultChunkResultLogger = LogChunkResult
 
 // LogChunkResult is the default ChunkResultLogger.
 func LogChunkResult(queue *Queue, result ChunkResult, currentChunkNumber int) {
-	percent := float32(currentChunkNumber) / float32(queue.chunkCount) * 100
+	chunkCount := queue.ChunkCount()
+	percent := float32(currentChunkNumber) / float32(chunkCount) * 100
 
 	if result.Err == nil {
 		percentPadding := ""
@@ -24,9 +25,9 @@ func LogChunkResult(queue *Queue, result ChunkResult, currentChunkNumber int) {
 
 		queue.Logger.Printf(
 			"[%*d/%d] %s%.2f %% done. lines: %d\n",
-			len(strconv.Itoa(queue.chunkCount)),
+			len(strconv.Itoa(chunkCount)),
 			result.Chunk.Id,
-			queue.chunkCount,
+			chunkCount,
 			percentPadding,
 			percent,
 			result.Lines,
@@ -34,9 +35,9 @@ func LogChunkResult(queue *Queue, result ChunkResult, currentChunkNumber int) {
 	} else {
 		queue.ErrLogger.Printf(
 			"[%*d/%d] %s\n",
-			len(strconv.Itoa(queue.chunkCount)),
+			len(strconv.Itoa(chunkCount)),
 			result.Chunk.Id,
-			queue.chunkCount,
+			chunkCount,
 			result.Err,
 		)
 	}
@@ -0,0 +1,132 @@
+package conveyor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrNoMatchingFiles is returned by PlanChunks if a path or pattern does not match any file.
+var ErrNoMatchingFiles = errors.New("no matching files")
+
+// FileBoundary describes the chunks of a single file inside a ChunkPlan.
+// FirstChunk and LastChunk are the ids of its first and last chunk.
+// Empty files have no chunks, which is indicated by LastChunk < FirstChunk.
+type FileBoundary struct {
+	FilePath   string
+	Size       int64
+	FirstChunk int
+	LastChunk  int
+}
+
+// ChunkPlan is the combined plan for multiple files.
+// The chunk ids are unique and contiguous across all files, so a single
+// ConcurrentWriter that keeps the order writes the output file by file.
+type ChunkPlan struct {
+	Chunks []Chunk
+	Files  []FileBoundary
+}
+
+// PlanChunks generates a ChunkPlan for the given paths. A path can either be
+// a file, a directory which is walked recursively or a glob pattern as
+// supported by filepath.Match. Directories and pattern matches are processed in
+// lexical order, files that are matched more than once are only planned once.
+func PlanChunks(paths []string, chunkSize int, out ChunkWriter) (*ChunkPlan, error) {
+	files, err := expandPaths(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &ChunkPlan{}
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+
+		firstChunk := len(plan.Chunks) + 1
+		chunks := getChunks(&FileReader{FilePath: file}, info.Size(), chunkSize, firstChunk, out)
+
+		plan.Chunks = append(plan.Chunks, chunks...)
+		plan.Files = append(plan.Files, FileBoundary{
+			FilePath:   file,
+			Size:       info.Size(),
+			FirstChunk: firstChunk,
+			LastChunk:  firstChunk + len(chunks) - 1,
+		})
+	}
+
+	return plan, nil
+}
+
+// File returns the FileBoundary of the file that contains the chunk with the given id.
+func (p *ChunkPlan) File(chunkId int) (FileBoundary, bool) {
+	i := sort.Search(len(p.Files), func(i int) bool {
+		return p.Files[i].LastChunk >= chunkId
+	})
+
+	if i == len(p.Files) || p.Files[i].FirstChunk > chunkId {
+		return FileBoundary{}, false
+	}
+
+	return p.Files[i], true
+}
+
+// expandPaths resolves all patterns and directories to a deduplicated list of files.
+func expandPaths(paths []string) ([]string, error) {
+	var (
+		files []string
+		seen  = make(map[string]bool)
+	)
+
+	add := func(file string) {
+		file = filepath.Clean(file)
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+
+	for _, path := range paths {
+		matches := []string{path}
+
+		if strings.ContainsAny(path, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(path); err != nil {
+				return nil, err
+			}
+
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("%w: %s", ErrNoMatchingFiles, path)
+			}
+		}
+
+		for _, match := range matches {
+			if err := walkFiles(match, add); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// walkFiles calls add for path if it is a regular file or for every regular
+// file inside of path if it is a directory.
+func walkFiles(path string, add func(string)) error {
+	return filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.Mode().IsRegular() {
+			add(file)
+		}
+
+		return nil
+	})
+}
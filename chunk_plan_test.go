@@ -0,0 +1,104 @@
+package conveyor_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fgehrlicher/conveyor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanChunks(t *testing.T) {
+	assertion := assert.New(t)
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"logs/app.log.1": "line 1\nline 2\nline 3\nline 4\n",
+		"logs/app.log.2": "line 5\nline 6\n",
+		"logs/empty.log": "",
+		"other.log":      strings.Repeat("0123456789\n", 10),
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assertion.NoError(os.MkdirAll(filepath.Dir(path), 0755))
+		assertion.NoError(ioutil.WriteFile(path, []byte(content), 0644))
+	}
+
+	buff := &bytes.Buffer{}
+	plan, err := conveyor.PlanChunks(
+		[]string{
+			filepath.Join(dir, "logs"),
+			filepath.Join(dir, "*.log"),
+			filepath.Join(dir, "logs", "app.log.1"),
+		},
+		11,
+		conveyor.NewConcurrentWriter(buff, true),
+	)
+	assertion.NoError(err)
+
+	assertion.Len(plan.Files, 4)
+	assertion.Equal(filepath.Join(dir, "logs", "app.log.1"), plan.Files[0].FilePath)
+	assertion.Equal(filepath.Join(dir, "other.log"), plan.Files[3].FilePath)
+	assertion.Less(plan.Files[2].LastChunk, plan.Files[2].FirstChunk)
+
+	for i, chunk := range plan.Chunks {
+		assertion.Equal(i+1, chunk.Id)
+
+		file, ok := plan.File(chunk.Id)
+		assertion.True(ok)
+		assertion.Equal(file.FilePath, chunk.In.GetHandleID())
+	}
+
+	_, ok := plan.File(len(plan.Chunks) + 1)
+	assertion.False(ok)
+
+	result := conveyor.NewQueue(
+		plan.Chunks,
+		4,
+		NullLineProcessor,
+		&conveyor.QueueOpts{
+			Logger:    NullLogger(),
+			ErrLogger: NullLogger(),
+		},
+	).Work()
+
+	assertion.Empty(result.FailedChunks)
+	assertion.Equal(int64(16), result.Lines)
+	assertion.Equal(files["logs/app.log.1"]+files["logs/app.log.2"]+files["other.log"], buff.String())
+}
+
+func TestPlanChunksSeparatesFilesWithoutTrailingDelimiter(t *testing.T) {
+	assertion := assert.New(t)
+	dir := t.TempDir()
+
+	assertion.NoError(ioutil.WriteFile(filepath.Join(dir, "a.log"), []byte("a1\na2"), 0644))
+	assertion.NoError(ioutil.WriteFile(filepath.Join(dir, "b.log"), []byte("b1\nb2\n"), 0644))
+	assertion.NoError(ioutil.WriteFile(filepath.Join(dir, "c.log"), []byte("c1\nc2"), 0644))
+
+	buff := &bytes.Buffer{}
+	plan, err := conveyor.PlanChunks([]string{filepath.Join(dir, "*.log")}, 4, conveyor.NewConcurrentWriter(buff, true))
+	assertion.NoError(err)
+
+	result := conveyor.NewQueue(plan.Chunks, 2, NullLineProcessor, &conveyor.QueueOpts{
+		Logger:    NullLogger(),
+		ErrLogger: NullLogger(),
+	}).Work()
+
+	assertion.Empty(result.FailedChunks)
+	assertion.Equal("a1\na2\nb1\nb2\nc1\nc2", buff.String())
+}
+
+func TestPlanChunksFailsForUnmatchedPattern(t *testing.T) {
+	assertion := assert.New(t)
+
+	_, err := conveyor.PlanChunks([]string{"testdata/*.unknown"}, 100, nil)
+	assertion.ErrorIs(err, conveyor.ErrNoMatchingFiles)
+
+	_, err = conveyor.PlanChunks([]string{"testdata/unknown.txt"}, 100, nil)
+	assertion.Error(err)
+}
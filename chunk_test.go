@@ -34,3 +34,11 @@ func TestChunkResultIsNotOkForErr(t *testing.T) {
 
 	assertion.False(chunkResult.Ok())
 }
+
+func TestGetChunksFromReaderReturnsCorrectChunks(t *testing.T) {
+	assertion := assert.New(t)
+	chunks, err := conveyor.GetChunksFromReader(&conveyor.FileReader{FilePath: chunkTestFile}, 100, nil)
+
+	assertion.NoError(err)
+	assertion.Equal(generateTestChunks(4, 100, chunkTestFile), chunks)
+}
@@ -0,0 +1,123 @@
+package conveyor
+
+import "bytes"
+
+// Chain returns a LineProcessor that passes every line through processors
+// in the given order. Every processor gets the output of the previous one
+// and the same LineMetadata. If a processor returns an empty result, the line
+// is dropped and the remaining processors are not called. The ChunkStartHook
+// and ChunkEndHook of the processors are called for every chunk.
+func Chain(processors ...LineProcessor) LineProcessor {
+	return composed(func(line []byte, metadata LineMetadata) ([]byte, error) {
+		var err error
+
+		for _, processor := range processors {
+			if len(line) == 0 {
+				return nil, nil
+			}
+
+			line, err = processor.Process(line, metadata)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return line, nil
+	}, processors...)
+}
+
+// Filter returns a LineProcessor that keeps the lines for which predicate
+// returns true and drops all others.
+func Filter(predicate func(line []byte, metadata LineMetadata) bool) LineProcessor {
+	return LineProcessorFunc(func(line []byte, metadata LineMetadata) ([]byte, error) {
+		if !predicate(line, metadata) {
+			return nil, nil
+		}
+
+		return line, nil
+	})
+}
+
+// Map returns a LineProcessor that replaces every line with the result of fn.
+// Like for every LineProcessor, an empty result drops the line.
+func Map(fn func(line []byte, metadata LineMetadata) []byte) LineProcessor {
+	return LineProcessorFunc(func(line []byte, metadata LineMetadata) ([]byte, error) {
+		return fn(line, metadata), nil
+	})
+}
+
+// Tee returns a LineProcessor that passes every line to side and returns
+// the line unchanged. The output of side is discarded, its errors are returned.
+// side must not modify or retain the line, e.g. a counter or a collector
+// that copies the lines. The ChunkStartHook and ChunkEndHook of side are
+// called for every chunk, e.g. for an Aggregator.
+func Tee(side LineProcessor) LineProcessor {
+	return composed(func(line []byte, metadata LineMetadata) ([]byte, error) {
+		if _, err := side.Process(line, metadata); err != nil {
+			return nil, err
+		}
+
+		return line, nil
+	}, side)
+}
+
+// composedProcessor is a LineProcessorFunc that calls the ChunkStartHook and
+// ChunkEndHook of the processors it is composed of.
+type composedProcessor struct {
+	LineProcessorFunc
+	processors []LineProcessor
+}
+
+func composed(fn LineProcessorFunc, processors ...LineProcessor) LineProcessor {
+	return composedProcessor{LineProcessorFunc: fn, processors: processors}
+}
+
+func (c composedProcessor) OnChunkStart(chunk Chunk) error {
+	for _, processor := range c.processors {
+		if hook, ok := processor.(ChunkStartHook); ok {
+			if err := hook.OnChunkStart(chunk); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c composedProcessor) OnChunkEnd(result ChunkResult) error {
+	for _, processor := range c.processors {
+		if hook, ok := processor.(ChunkEndHook); ok {
+			if err := hook.OnChunkEnd(result); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// FlatMap returns a LineProcessor that replaces every line with any number of
+// lines. fn gets the line without its trailing delimiter and returns the new
+// lines without delimiters. They are joined with the Sequence of delimiter,
+// which defaults to DefaultDelimiter and must match the Delimiter of the Queue.
+// If fn returns no lines, the line is dropped. Processors that follow
+// FlatMap in a Chain get all new lines as a single line.
+func FlatMap(fn func(line []byte, metadata LineMetadata) ([][]byte, error), delimiter ...Delimiter) LineProcessor {
+	sequence := optionalDelimiter(delimiter).Sequence
+
+	return LineProcessorFunc(func(line []byte, metadata LineMetadata) ([]byte, error) {
+		content := bytes.TrimSuffix(line, sequence)
+
+		lines, err := fn(content, metadata)
+		if err != nil || len(lines) == 0 {
+			return nil, err
+		}
+
+		out := bytes.Join(lines, sequence)
+		if len(content) < len(line) {
+			out = append(out, sequence...)
+		}
+
+		return out, nil
+	})
+}
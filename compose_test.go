@@ -0,0 +1,176 @@
+package conveyor_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fgehrlicher/conveyor"
+	"github.com/stretchr/testify/assert"
+)
+
+var errCompose = errors.New("compose error")
+
+func upper(line []byte, _ conveyor.LineMetadata) []byte {
+	return bytes.ToUpper(line)
+}
+
+func TestChain(t *testing.T) {
+	assertion := assert.New(t)
+	metadata := conveyor.LineMetadata{WorkerId: 3, Line: 7}
+
+	var calls int
+	checkMetadata := conveyor.LineProcessorFunc(func(line []byte, m conveyor.LineMetadata) ([]byte, error) {
+		calls++
+		assertion.Equal(metadata, m)
+		return line, nil
+	})
+
+	out, err := conveyor.Chain(checkMetadata, conveyor.Map(upper), checkMetadata).Process([]byte("abc\n"), metadata)
+	assertion.NoError(err)
+	assertion.Equal("ABC\n", string(out))
+	assertion.Equal(2, calls)
+
+	out, err = conveyor.Chain().Process([]byte("abc\n"), metadata)
+	assertion.NoError(err)
+	assertion.Equal("abc\n", string(out))
+
+	drop := conveyor.Map(func([]byte, conveyor.LineMetadata) []byte { return nil })
+	out, err = conveyor.Chain(drop, checkMetadata).Process([]byte("abc\n"), metadata)
+	assertion.NoError(err)
+	assertion.Empty(out)
+	assertion.Equal(2, calls)
+
+	fail := conveyor.LineProcessorFunc(func([]byte, conveyor.LineMetadata) ([]byte, error) {
+		return nil, errCompose
+	})
+	out, err = conveyor.Chain(fail, checkMetadata).Process([]byte("abc\n"), metadata)
+	assertion.ErrorIs(err, errCompose)
+	assertion.Empty(out)
+	assertion.Equal(2, calls)
+}
+
+func TestFilter(t *testing.T) {
+	assertion := assert.New(t)
+
+	evenLines := conveyor.Filter(func(_ []byte, metadata conveyor.LineMetadata) bool {
+		return metadata.Line%2 == 0
+	})
+
+	out, err := evenLines.Process([]byte("abc\n"), conveyor.LineMetadata{Line: 2})
+	assertion.NoError(err)
+	assertion.Equal("abc\n", string(out))
+
+	out, err = evenLines.Process([]byte("abc\n"), conveyor.LineMetadata{Line: 3})
+	assertion.NoError(err)
+	assertion.Empty(out)
+}
+
+func TestTee(t *testing.T) {
+	assertion := assert.New(t)
+
+	var seen []string
+	collect := conveyor.LineProcessorFunc(func(line []byte, _ conveyor.LineMetadata) ([]byte, error) {
+		seen = append(seen, string(line))
+		return nil, nil
+	})
+
+	out, err := conveyor.Tee(collect).Process([]byte("abc\n"), conveyor.LineMetadata{})
+	assertion.NoError(err)
+	assertion.Equal("abc\n", string(out))
+	assertion.Equal([]string{"abc\n"}, seen)
+
+	fail := conveyor.LineProcessorFunc(func([]byte, conveyor.LineMetadata) ([]byte, error) {
+		return []byte("ignored"), errCompose
+	})
+	out, err = conveyor.Tee(fail).Process([]byte("abc\n"), conveyor.LineMetadata{})
+	assertion.ErrorIs(err, errCompose)
+	assertion.Empty(out)
+}
+
+func TestFlatMap(t *testing.T) {
+	assertion := assert.New(t)
+
+	splitWords := func(line []byte, _ conveyor.LineMetadata) ([][]byte, error) {
+		if bytes.Equal(line, []byte("fail")) {
+			return nil, errCompose
+		}
+
+		return bytes.Fields(line), nil
+	}
+
+	testCases := []struct {
+		name      string
+		delimiter []conveyor.Delimiter
+		in        string
+		out       string
+		err       error
+	}{
+		{name: "multiple words", in: "a b c\n", out: "a\nb\nc\n"},
+		{name: "last line of chunk", in: "a b c", out: "a\nb\nc"},
+		{name: "single word", in: "a\n", out: "a\n"},
+		{name: "no words", in: "   \n", out: ""},
+		{name: "error", in: "fail\n", err: errCompose},
+		{name: "nul delimiter", delimiter: []conveyor.Delimiter{conveyor.NUL}, in: "a b\x00", out: "a\x00b\x00"},
+	}
+
+	for _, testCase := range testCases {
+		out, err := conveyor.FlatMap(splitWords, testCase.delimiter...).Process([]byte(testCase.in), conveyor.LineMetadata{})
+		assertion.ErrorIs(err, testCase.err, testCase.name)
+		assertion.Equal(testCase.out, string(out), testCase.name)
+	}
+}
+
+func TestComposedProcessorQueue(t *testing.T) {
+	var (
+		assertion = assert.New(t)
+		lines     = 200
+		content   strings.Builder
+		expected  strings.Builder
+		seen      int64
+	)
+
+	for i := 1; i <= lines; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+		if i%2 == 0 {
+			fmt.Fprintf(&expected, "LINE\n%d\n", i)
+		}
+	}
+
+	testFile := filepath.Join(t.TempDir(), "lines.txt")
+	assertion.NoError(ioutil.WriteFile(testFile, []byte(content.String()), 0644))
+
+	processor := conveyor.Chain(
+		conveyor.Tee(conveyor.LineProcessorFunc(func([]byte, conveyor.LineMetadata) ([]byte, error) {
+			atomic.AddInt64(&seen, 1)
+			return nil, nil
+		})),
+		conveyor.Filter(func(line []byte, _ conveyor.LineMetadata) bool {
+			number := bytes.TrimSuffix(line, []byte{'\n'})
+			return (number[len(number)-1]-'0')%2 == 0
+		}),
+		conveyor.Map(upper),
+		conveyor.FlatMap(func(line []byte, _ conveyor.LineMetadata) ([][]byte, error) {
+			return bytes.Fields(line), nil
+		}),
+	)
+
+	out := &bytes.Buffer{}
+	chunks, err := conveyor.GetChunksFromFile(testFile, 64, conveyor.NewConcurrentWriter(out, true))
+	assertion.NoError(err)
+
+	result := conveyor.NewQueue(chunks, 4, processor, &conveyor.QueueOpts{
+		Logger:    NullLogger(),
+		ErrLogger: NullLogger(),
+	}).Work()
+
+	assertion.Empty(result.FailedChunks)
+	assertion.Equal(int64(lines), result.Lines)
+	assertion.Equal(int64(lines), atomic.LoadInt64(&seen))
+	assertion.Equal(expected.String(), out.String())
+}
@@ -0,0 +1,131 @@
+package conveyor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressingWriter is a ChunkWriter that compresses the output of every chunk
+// into an independent gzip member or zstd frame. The compression happens in
+// the worker goroutine that calls Write, so it scales with the number of
+// workers. The compressed chunks are written by a ConcurrentWriter, which
+// also keeps their order if requested. Since concatenated gzip members and
+// zstd frames are valid streams, the output can be decompressed as a whole.
+// A CompressingWriter that keeps the order can not be resumed, so a Queue
+// with a Checkpoint fails with ErrResumeNotSupported for it.
+type CompressingWriter struct {
+	writer      *ConcurrentWriter
+	compression Compression
+	delimiter   []byte
+
+	gzipWriters sync.Pool
+	zstdEncoder *zstd.Encoder
+}
+
+// gzipCompressor is a reusable gzip.Writer and its output buffer.
+type gzipCompressor struct {
+	buff   bytes.Buffer
+	writer *gzip.Writer
+}
+
+// NewCompressingWriter returns a new CompressingWriter for the given
+// Compression. Only Gzip and Zstd are supported. The optional Delimiter
+// works like for NewConcurrentWriter.
+func NewCompressingWriter(
+	writer io.Writer,
+	keepOrder bool,
+	compression Compression,
+	delimiter ...Delimiter,
+) (*CompressingWriter, error) {
+	c := &CompressingWriter{
+		writer:      NewConcurrentWriter(writer, keepOrder),
+		compression: compression,
+	}
+
+	switch compression {
+	case Gzip:
+		c.gzipWriters.New = func() interface{} {
+			compressor := &gzipCompressor{}
+			compressor.writer = gzip.NewWriter(&compressor.buff)
+			return compressor
+		}
+	case Zstd:
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		c.zstdEncoder = encoder
+	default:
+		return nil, ErrUnsupportedCompression
+	}
+
+	c.delimiter = optionalDelimiter(delimiter).Sequence
+
+	separator, err := c.compress(c.delimiter)
+	if err != nil {
+		return nil, err
+	}
+
+	c.writer.separator = separator
+	return c, nil
+}
+
+// Write compresses buff and passes it on to the underlying ConcurrentWriter.
+func (c *CompressingWriter) Write(chunk *Chunk, buff []byte) error {
+	if len(buff) == 0 {
+		return c.writer.Write(chunk, nil)
+	}
+
+	compressed, err := c.compress(buff)
+	if err != nil {
+		return err
+	}
+
+	return c.writer.write(chunk, compressed, chunk.eof && bytes.HasSuffix(buff, c.delimiter))
+}
+
+// KeepsOrder reports whether the chunks are written in order of their ids.
+func (c *CompressingWriter) KeepsOrder() bool {
+	return c.writer.KeepsOrder()
+}
+
+// Close releases the resources of the zstd encoder.
+// It does not close the underlying io.Writer.
+func (c *CompressingWriter) Close() error {
+	if c.zstdEncoder != nil {
+		return c.zstdEncoder.Close()
+	}
+
+	return nil
+}
+
+// compress returns buff compressed as a single gzip member or zstd frame.
+func (c *CompressingWriter) compress(buff []byte) ([]byte, error) {
+	if c.compression == Zstd {
+		return c.zstdEncoder.EncodeAll(buff, nil), nil
+	}
+
+	compressor := c.gzipWriters.Get().(*gzipCompressor)
+	defer c.gzipWriters.Put(compressor)
+
+	compressor.buff.Reset()
+	compressor.writer.Reset(&compressor.buff)
+
+	if _, err := compressor.writer.Write(buff); err != nil {
+		return nil, err
+	}
+
+	if err := compressor.writer.Close(); err != nil {
+		return nil, err
+	}
+
+	compressed := make([]byte, compressor.buff.Len())
+	copy(compressed, compressor.buff.Bytes())
+
+	return compressed, nil
+}
@@ -0,0 +1,57 @@
+package conveyor_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/fgehrlicher/conveyor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressingWriter(t *testing.T) {
+	var (
+		assertion      = assert.New(t)
+		testFile       = "testdata/data.txt"
+		testResultFile = "testdata/converted_data.txt"
+	)
+
+	expectedFile, err := ioutil.ReadFile(testResultFile)
+	assertion.NoError(err)
+
+	for _, compression := range []conveyor.Compression{conveyor.Gzip, conveyor.Zstd} {
+		buff := &bytes.Buffer{}
+		writer, err := conveyor.NewCompressingWriter(buff, true, compression)
+		assertion.NoError(err)
+
+		chunks, err := conveyor.GetChunksFromFile(testFile, 200, writer)
+		assertion.NoError(err)
+
+		result := conveyor.NewQueue(
+			chunks,
+			4,
+			conveyor.LineProcessorFunc(Redact),
+			&conveyor.QueueOpts{
+				Logger:    NullLogger(),
+				ErrLogger: NullLogger(),
+			},
+		).Work()
+
+		assertion.Empty(result.FailedChunks)
+		assertion.NoError(writer.Close())
+
+		decompressor, err := conveyor.NewDecompressor(buff, compression)
+		assertion.NoError(err)
+
+		actualFile, err := ioutil.ReadAll(decompressor)
+		assertion.NoError(err)
+		assertion.NoError(decompressor.Close())
+
+		assertion.Equal(expectedFile, actualFile, "compression %d", compression)
+	}
+}
+
+func TestCompressingWriterUnsupportedCompression(t *testing.T) {
+	_, err := conveyor.NewCompressingWriter(&bytes.Buffer{}, true, conveyor.Bzip2)
+	assert.ErrorIs(t, err, conveyor.ErrUnsupportedCompression)
+}
@@ -0,0 +1,64 @@
+package conveyor
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrUnsupportedCompression is returned for compression formats that are
+// not supported by an operation.
+var ErrUnsupportedCompression = errors.New("unsupported compression")
+
+// Compression is a compression format supported by Conveyor.
+type Compression int
+
+const (
+	NoCompression Compression = iota
+	Gzip
+	Zstd
+	Bzip2
+)
+
+// CompressionFromPath detects the Compression by the file extension of path.
+func CompressionFromPath(path string) Compression {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz", ".gzip", ".bgz":
+		return Gzip
+	case ".zst", ".zstd":
+		return Zstd
+	case ".bz2":
+		return Bzip2
+	default:
+		return NoCompression
+	}
+}
+
+// NewDecompressor wraps r with a reader that decompresses the given Compression.
+// Concatenated gzip members and zstd frames are decompressed as a single stream.
+func NewDecompressor(r io.Reader, compression Compression) (io.ReadCloser, error) {
+	switch compression {
+	case NoCompression:
+		return ioutil.NopCloser(r), nil
+	case Gzip:
+		return gzip.NewReader(bufio.NewReader(r))
+	case Zstd:
+		decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+
+		return decoder.IOReadCloser(), nil
+	case Bzip2:
+		return ioutil.NopCloser(bzip2.NewReader(r)), nil
+	default:
+		return nil, ErrUnsupportedCompression
+	}
+}
@@ -0,0 +1,333 @@
+package conveyor
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var (
+	// ErrUnknownColumn is returned by CSVRecord.Set for columns that are not
+	// part of the header.
+	ErrUnknownColumn = errors.New("unknown column")
+
+	// ErrMultipleRecords is returned by CSVProcessor if a line contains more
+	// than one CSV record, e.g. because the Queue does not use the CSV Delimiter
+	// for input with quoted line breaks.
+	ErrMultipleRecords = errors.New("line contains multiple records")
+)
+
+// The CSVRecordFunc type is the function called by CSVProcessor for every
+// record except the header. It returns the record that is written to the
+// output, which is usually the modified input record. A nil record drops the line.
+type CSVRecordFunc func(record *CSVRecord, metadata LineMetadata) (*CSVRecord, error)
+
+// CSVOpts configures CSVProcessor.
+type CSVOpts struct {
+	// Comma is the field delimiter. It defaults to ','.
+	Comma rune
+
+	// Header replaces the header of the input in the output, e.g. if
+	// the CSVRecordFunc adds or removes columns.
+	Header []string
+
+	// SkipHeader drops the header from the output.
+	SkipHeader bool
+}
+
+// CSVProcessor is a LineProcessor for RFC 4180 CSV input. It parses every line
+// and passes it to a CSVRecordFunc as CSVRecord, whose fields are addressable
+// by the column names of the header. The returned record is encoded again with
+// correct quoting. The header is the first record of every ChunkReader and is
+// read once per ChunkReader, so the chunks can be processed in any order.
+// The ChunkReader must be seekable to offset 0, which is not the case for
+// chunks submitted with Queue.SubmitStream.
+//
+// Records with quoted line breaks require the CSV Delimiter, see QueueOpts.Delimiter.
+// Records end with the Sequence of LineMetadata.Delimiter, which is removed
+// from every record before it is parsed and appended to the output record.
+type CSVProcessor struct {
+	fn   CSVRecordFunc
+	opts *CSVOpts
+
+	codecs  sync.Pool
+	headers map[string]*csvHeader
+	sync.Mutex
+}
+
+// NewCSVProcessor returns a new CSVProcessor that calls fn for every record.
+func NewCSVProcessor(fn CSVRecordFunc, opts ...*CSVOpts) *CSVProcessor {
+	opt := &CSVOpts{}
+	if len(opts) > 0 && opts[0] != nil {
+		opt = opts[0]
+	}
+
+	if opt.Comma == 0 {
+		opt.Comma = ','
+	}
+
+	c := &CSVProcessor{
+		fn:      fn,
+		opts:    opt,
+		headers: make(map[string]*csvHeader),
+	}
+
+	c.codecs.New = func() interface{} {
+		return newCSVCodec(opt.Comma)
+	}
+
+	return c
+}
+
+// Process parses line, calls the CSVRecordFunc and encodes its result.
+func (c *CSVProcessor) Process(line []byte, metadata LineMetadata) ([]byte, error) {
+	delimiter := metadata.Delimiter.orDefault().Sequence
+
+	header, err := c.header(metadata.Chunk.In, delimiter)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading csv header: %w", err)
+	}
+
+	codec := c.codecs.Get().(*csvCodec)
+	defer c.codecs.Put(codec)
+
+	// The last line of a chunk has no delimiter.
+	content := bytes.TrimSuffix(line, delimiter)
+	var sequence []byte
+	if len(content) < len(line) {
+		sequence = delimiter
+	}
+
+	if metadata.Chunk.Offset == 0 && metadata.Line == 1 {
+		switch {
+		case c.opts.SkipHeader:
+			return nil, nil
+		case c.opts.Header != nil:
+			return codec.encode(c.opts.Header, content, sequence)
+		default:
+			return codec.encode(header.columns, content, sequence)
+		}
+	}
+
+	fields, err := codec.decode(content)
+	if err != nil || fields == nil {
+		return nil, err
+	}
+
+	if len(fields) != len(header.columns) {
+		return nil, fmt.Errorf(
+			"%w: record has %d fields, header has %d",
+			csv.ErrFieldCount,
+			len(fields),
+			len(header.columns),
+		)
+	}
+
+	record, err := c.fn(&CSVRecord{Fields: fields, header: header}, metadata)
+	if err != nil || record == nil {
+		return nil, err
+	}
+
+	return codec.encode(record.Fields, content, sequence)
+}
+
+// header returns the header of in, which ends with sequence. It is read once
+// for every ChunkReader.
+func (c *CSVProcessor) header(in ChunkReader, sequence []byte) (*csvHeader, error) {
+	c.Lock()
+	header, ok := c.headers[in.GetHandleID()]
+	if !ok {
+		header = &csvHeader{}
+		c.headers[in.GetHandleID()] = header
+	}
+	c.Unlock()
+
+	header.once.Do(func() {
+		header.err = header.read(in, c.opts.Comma, sequence)
+	})
+
+	return header, header.err
+}
+
+// CSVRecord is a single CSV record. Its fields are addressable by
+// the column names of the header.
+type CSVRecord struct {
+	Fields []string
+
+	header *csvHeader
+}
+
+// Columns returns the column names of the header.
+func (r *CSVRecord) Columns() []string {
+	return r.header.columns
+}
+
+// Get returns the field of column. It returns an empty string if
+// the column does not exist.
+func (r *CSVRecord) Get(column string) string {
+	value, _ := r.Lookup(column)
+	return value
+}
+
+// Lookup returns the field of column and whether the column exists.
+func (r *CSVRecord) Lookup(column string) (string, bool) {
+	i, ok := r.header.index[column]
+	if !ok || i >= len(r.Fields) {
+		return "", false
+	}
+
+	return r.Fields[i], true
+}
+
+// Set sets the field of column to value.
+func (r *CSVRecord) Set(column string, value string) error {
+	i, ok := r.header.index[column]
+	if !ok || i >= len(r.Fields) {
+		return fmt.Errorf("%w: %s", ErrUnknownColumn, column)
+	}
+
+	r.Fields[i] = value
+	return nil
+}
+
+// csvHeader holds the column names of a ChunkReader.
+type csvHeader struct {
+	once    sync.Once
+	err     error
+	columns []string
+	index   map[string]int
+}
+
+// read reads the first record of in, which ends with the first sequence
+// outside of quotes.
+func (h *csvHeader) read(in ChunkReader, comma rune, sequence []byte) error {
+	handle, err := in.OpenHandle()
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+
+	if _, err = handle.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var (
+		delimiter = Delimiter{Sequence: sequence, Quote: '"'}
+		block     = make([]byte, 4096)
+		record    []byte
+	)
+
+	for {
+		n, readErr := handle.Read(block)
+		record = append(record, block[:n]...)
+
+		if i := delimiter.index(record, false); i != -1 {
+			record = record[:i]
+			break
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+
+		if readErr != nil {
+			return readErr
+		}
+	}
+
+	h.columns, err = newCSVCodec(comma).decode(record)
+	if err != nil {
+		return err
+	}
+
+	if h.columns == nil {
+		return io.EOF
+	}
+
+	h.index = make(map[string]int, len(h.columns))
+	for i, column := range h.columns {
+		if _, ok := h.index[column]; !ok {
+			h.index[column] = i
+		}
+	}
+
+	return nil
+}
+
+// csvCodec decodes and encodes single lines. The csv.Reader reads from
+// in, which is reset for every line, so both can be reused.
+type csvCodec struct {
+	in     *bytes.Reader
+	reader *csv.Reader
+	out    bytes.Buffer
+	writer *csv.Writer
+}
+
+func newCSVCodec(comma rune) *csvCodec {
+	codec := &csvCodec{in: bytes.NewReader(nil)}
+
+	codec.reader = csv.NewReader(codec.in)
+	codec.reader.Comma = comma
+	codec.reader.FieldsPerRecord = -1
+
+	codec.writer = csv.NewWriter(&codec.out)
+	codec.writer.Comma = comma
+
+	return codec
+}
+
+// decode returns the fields of the single record in line. Empty lines
+// have no fields.
+func (c *csvCodec) decode(line []byte) ([]string, error) {
+	c.in.Reset(line)
+
+	fields, err := c.reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+
+	if err == nil {
+		if _, err = c.reader.Read(); err == io.EOF {
+			return fields, nil
+		}
+
+		err = ErrMultipleRecords
+	}
+
+	// The rest of line must be consumed before the reader is reused.
+	for drainErr := error(nil); drainErr != io.EOF; {
+		_, drainErr = c.reader.Read()
+	}
+
+	return nil, err
+}
+
+// encode returns fields as CSV record followed by sequence. Like content,
+// the record uses CRLF line breaks if content ends with '\r'.
+func (c *csvCodec) encode(fields []string, content []byte, sequence []byte) ([]byte, error) {
+	c.out.Reset()
+	c.writer.UseCRLF = bytes.HasSuffix(content, []byte{'\r'})
+
+	if err := c.writer.Write(fields); err != nil {
+		return nil, err
+	}
+
+	c.writer.Flush()
+	if err := c.writer.Error(); err != nil {
+		return nil, err
+	}
+
+	out := bytes.TrimSuffix(c.out.Bytes(), []byte{'\n'})
+	if !c.writer.UseCRLF || len(sequence) == 0 {
+		out = bytes.TrimSuffix(out, []byte{'\r'})
+	}
+
+	record := make([]byte, len(out)+len(sequence))
+	copy(record, out)
+	copy(record[len(out):], sequence)
+
+	return record, nil
+}
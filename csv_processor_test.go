@@ -0,0 +1,193 @@
+package conveyor_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fgehrlicher/conveyor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSVProcessor(t *testing.T) {
+	var (
+		assertion = assert.New(t)
+		testFile  = "testdata/animal_notes.csv"
+	)
+
+	input, err := ioutil.ReadFile(testFile)
+	assertion.NoError(err)
+
+	expectedRecords, err := csv.NewReader(bytes.NewReader(input)).ReadAll()
+	assertion.NoError(err)
+
+	for _, record := range expectedRecords[1:] {
+		record[1] = strings.ToUpper(record[1])
+		record[2] = strings.ReplaceAll(record[2], "quoted", "quoted, \"twice\"")
+	}
+
+	for _, workers := range []int{1, 4} {
+		out := &bytes.Buffer{}
+		writer := conveyor.NewConcurrentWriter(out, true, conveyor.CSV)
+
+		chunks, err := conveyor.GetChunksFromFile(testFile, 512, writer)
+		assertion.NoError(err)
+		assertion.NoError(conveyor.ScanQuotes(chunks, '"'))
+
+		processor := conveyor.NewCSVProcessor(func(record *conveyor.CSVRecord, _ conveyor.LineMetadata) (*conveyor.CSVRecord, error) {
+			if err := record.Set("name", strings.ToUpper(record.Get("name"))); err != nil {
+				return nil, err
+			}
+
+			notes, ok := record.Lookup("notes")
+			assertion.True(ok)
+
+			return record, record.Set("notes", strings.ReplaceAll(notes, "quoted", "quoted, \"twice\""))
+		})
+
+		result := conveyor.NewQueue(chunks, workers, processor, &conveyor.QueueOpts{
+			Delimiter: conveyor.CSV,
+			Logger:    NullLogger(),
+			ErrLogger: NullLogger(),
+		}).Work()
+
+		assertion.Empty(result.FailedChunks)
+
+		records, err := csv.NewReader(out).ReadAll()
+		assertion.NoError(err)
+		assertion.Equal(expectedRecords, records)
+	}
+}
+
+func TestCSVProcessorHeaderOptions(t *testing.T) {
+	assertion := assert.New(t)
+	testFile := filepath.Join(t.TempDir(), "people.csv")
+	assertion.NoError(ioutil.WriteFile(testFile, []byte("id;name\n1;alice\n2;bob\n"), 0644))
+
+	tt := []struct {
+		Opts           *conveyor.CSVOpts
+		ExpectedOutput string
+	}{
+		{
+			Opts:           &conveyor.CSVOpts{Comma: ';'},
+			ExpectedOutput: "id;name\n1;alice\n2;bob\n",
+		},
+		{
+			Opts:           &conveyor.CSVOpts{Comma: ';', Header: []string{"id", "name", "length"}},
+			ExpectedOutput: "id;name;length\n1;alice;5\n2;bob;3\n",
+		},
+		{
+			Opts:           &conveyor.CSVOpts{Comma: ';', SkipHeader: true},
+			ExpectedOutput: "1;alice\n2;bob\n",
+		},
+	}
+
+	for _, test := range tt {
+		out := &bytes.Buffer{}
+		chunks, err := conveyor.GetChunksFromFile(testFile, 8, conveyor.NewConcurrentWriter(out, true))
+		assertion.NoError(err)
+
+		addLength := len(test.Opts.Header) == 3
+		processor := conveyor.NewCSVProcessor(func(record *conveyor.CSVRecord, _ conveyor.LineMetadata) (*conveyor.CSVRecord, error) {
+			assertion.Equal([]string{"id", "name"}, record.Columns())
+
+			if addLength {
+				record.Fields = append(record.Fields, string(rune('0'+len(record.Get("name")))))
+			}
+
+			return record, nil
+		}, test.Opts)
+
+		result := conveyor.NewQueue(chunks, 2, processor, &conveyor.QueueOpts{
+			Logger:    NullLogger(),
+			ErrLogger: NullLogger(),
+		}).Work()
+
+		assertion.Empty(result.FailedChunks)
+		assertion.Equal(test.ExpectedOutput, out.String())
+	}
+}
+
+func TestCSVProcessorDelimiter(t *testing.T) {
+	assertion := assert.New(t)
+	testFile := filepath.Join(t.TempDir(), "people.csv")
+
+	var input, expectedOutput strings.Builder
+	input.WriteString("id,name\x00")
+	expectedOutput.WriteString("id,name\x00")
+
+	for i := 1; i <= 50; i++ {
+		fmt.Fprintf(&input, "%d,\"alice\n%d\"\x00", i, i)
+		fmt.Fprintf(&expectedOutput, "%d,\"ALICE\n%d\"\x00", i, i)
+	}
+
+	assertion.NoError(ioutil.WriteFile(testFile, []byte(input.String()), 0644))
+
+	out := &bytes.Buffer{}
+	chunks, err := conveyor.GetChunksFromFile(testFile, 64, conveyor.NewConcurrentWriter(out, true, conveyor.NUL))
+	assertion.NoError(err)
+
+	processor := conveyor.NewCSVProcessor(func(record *conveyor.CSVRecord, _ conveyor.LineMetadata) (*conveyor.CSVRecord, error) {
+		return record, record.Set("name", strings.ToUpper(record.Get("name")))
+	})
+
+	result := conveyor.NewQueue(chunks, 4, processor, &conveyor.QueueOpts{
+		Logger:    NullLogger(),
+		ErrLogger: NullLogger(),
+		Delimiter: conveyor.NUL,
+	}).Work()
+
+	assertion.Empty(result.FailedChunks)
+	assertion.Equal(int64(51), result.Lines)
+	assertion.Equal(expectedOutput.String(), out.String())
+}
+
+func TestCSVProcessorErrors(t *testing.T) {
+	assertion := assert.New(t)
+	testFile := filepath.Join(t.TempDir(), "invalid.csv")
+	assertion.NoError(ioutil.WriteFile(testFile, []byte("a,b\n1,2,3\n\"x\ny\",z\n1,\"2\n"), 0644))
+
+	chunks, err := conveyor.GetChunksFromFile(testFile, 64, nil)
+	assertion.NoError(err)
+
+	processor := conveyor.NewCSVProcessor(func(record *conveyor.CSVRecord, _ conveyor.LineMetadata) (*conveyor.CSVRecord, error) {
+		assertion.ErrorIs(record.Set("c", "value"), conveyor.ErrUnknownColumn)
+		assertion.Empty(record.Get("c"))
+		return record, nil
+	})
+
+	result := conveyor.NewQueue(chunks, 1, processor, &conveyor.QueueOpts{
+		Logger:          NullLogger(),
+		ErrLogger:       NullLogger(),
+		LineErrorPolicy: conveyor.SkipLine,
+	}).Work()
+
+	assertion.Empty(result.FailedChunks)
+	lineErrors := result.Results[0].LineErrors
+	assertion.Len(lineErrors, 4)
+	assertion.ErrorIs(lineErrors[0], csv.ErrFieldCount)
+	assertion.ErrorIs(lineErrors[1], csv.ErrQuote)
+	assertion.ErrorIs(lineErrors[3], csv.ErrQuote)
+}
+
+func TestCSVProcessorHeaderReadError(t *testing.T) {
+	assertion := assert.New(t)
+	testFile := filepath.Join(t.TempDir(), "data.csv")
+	assertion.NoError(ioutil.WriteFile(testFile, []byte("a,b\n1,2\n"), 0644))
+
+	chunks, err := conveyor.GetChunksFromFile(testFile, 64, nil)
+	assertion.NoError(err)
+	assertion.NoError(os.Remove(testFile))
+
+	processor := conveyor.NewCSVProcessor(func(record *conveyor.CSVRecord, _ conveyor.LineMetadata) (*conveyor.CSVRecord, error) {
+		return record, nil
+	})
+
+	_, err = processor.Process([]byte("1,2\n"), conveyor.LineMetadata{Chunk: &chunks[0], Line: 2})
+	assertion.ErrorIs(err, os.ErrNotExist)
+}
@@ -0,0 +1,33 @@
+package conveyor
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// The DeadLetterFormatter type is the function that formats a rejected line
+// for the dead letter ChunkWriter. The returned record must not contain a
+// trailing line break, records are separated by Worker.
+type DeadLetterFormatter func(lineErr *LineError, line []byte) []byte
+
+// DefaultDeadLetterFormatter is the default formatter used by Worker.
+var DefaultDeadLetterFormatter = FormatDeadLetter
+
+// FormatDeadLetter is the default DeadLetterFormatter.
+// It returns a tab separated record of the chunk id, the line number, the byte
+// offset, the quoted error message and the raw line without its line break.
+func FormatDeadLetter(lineErr *LineError, line []byte) []byte {
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+
+	record := make([]byte, 0, len(line)+64)
+	record = strconv.AppendInt(record, int64(lineErr.ChunkId), 10)
+	record = append(record, '\t')
+	record = strconv.AppendInt(record, int64(lineErr.Line), 10)
+	record = append(record, '\t')
+	record = strconv.AppendInt(record, lineErr.Offset, 10)
+	record = append(record, '\t')
+	record = strconv.AppendQuote(record, lineErr.Err.Error())
+	record = append(record, '\t')
+
+	return append(record, line...)
+}
@@ -0,0 +1,140 @@
+package conveyor_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/fgehrlicher/conveyor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatDeadLetter(t *testing.T) {
+	assertion := assert.New(t)
+
+	record := conveyor.FormatDeadLetter(
+		&conveyor.LineError{ChunkId: 3, Line: 7, Offset: 1024, Err: errors.New("invalid \"line\"")},
+		[]byte("a\tb\n"),
+	)
+
+	assertion.Equal("3\t7\t1024\t\"invalid \\\"line\\\"\"\ta\tb", string(record))
+}
+
+func TestQueueWritesDeadLetters(t *testing.T) {
+	var (
+		assertion   = assert.New(t)
+		testFile    = "testdata/data.txt"
+		expectedErr = errors.New("contains lorem")
+	)
+
+	out := &bytes.Buffer{}
+	deadLetters := &bytes.Buffer{}
+
+	chunks, err := conveyor.GetChunksFromFile(testFile, 512, conveyor.NewConcurrentWriter(out, true))
+	assertion.NoError(err)
+
+	result := conveyor.NewQueue(
+		chunks,
+		4,
+		conveyor.LineProcessorFunc(func(line []byte, metadata conveyor.LineMetadata) ([]byte, error) {
+			if bytes.Contains(line, []byte("Lorem")) {
+				return nil, expectedErr
+			}
+
+			return line, nil
+		}),
+		&conveyor.QueueOpts{
+			Logger:          NullLogger(),
+			ErrLogger:       NullLogger(),
+			LineErrorPolicy: conveyor.SkipLine,
+			DeadLetter:      conveyor.NewConcurrentWriter(deadLetters, true),
+		},
+	).Work()
+
+	assertion.Empty(result.FailedChunks)
+	assertion.Equal(int64(100), result.Lines)
+
+	records := strings.Split(deadLetters.String(), "\n")
+	assertion.NotEmpty(records)
+
+	var rejectedLines int
+	for _, chunkResult := range result.Results {
+		rejectedLines += len(chunkResult.LineErrors)
+	}
+
+	assertion.Len(records, rejectedLines)
+
+	input, err := ioutil.ReadFile(testFile)
+	assertion.NoError(err)
+
+	for _, record := range records {
+		fields := strings.SplitN(record, "\t", 5)
+		assertion.Len(fields, 5)
+		assertion.Contains(fields[4], "Lorem")
+		assertion.Equal(`"contains lorem"`, fields[3])
+
+		offset, err := strconv.Atoi(fields[2])
+		assertion.NoError(err)
+		assertion.True(bytes.HasPrefix(input[offset:], []byte(fields[4])))
+	}
+
+	assertion.NotContains(out.String(), "Lorem")
+}
+
+// cancelingProcessor skips lines containing "Lorem" and cancels the run
+// once the first chunk is done.
+type cancelingProcessor struct {
+	cancel context.CancelFunc
+}
+
+func (c *cancelingProcessor) Process(line []byte, metadata conveyor.LineMetadata) ([]byte, error) {
+	if bytes.Contains(line, []byte("Lorem")) {
+		return nil, errors.New("contains lorem")
+	}
+
+	return line, nil
+}
+
+func (c *cancelingProcessor) OnChunkEnd(result conveyor.ChunkResult) error {
+	if result.Chunk.Id == 1 {
+		c.cancel()
+	}
+
+	return nil
+}
+
+func TestQueueWritesDeadLettersOfChunksCompletedAfterCancel(t *testing.T) {
+	assertion := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	out := &bytes.Buffer{}
+	deadLetters := &bytes.Buffer{}
+
+	chunks, err := conveyor.GetChunksFromFile("testdata/data.txt", 512, conveyor.NewConcurrentWriter(out, true))
+	assertion.NoError(err)
+
+	result := conveyor.NewQueue(chunks, 1, &cancelingProcessor{cancel: cancel}, &conveyor.QueueOpts{
+		Logger:          NullLogger(),
+		ErrLogger:       NullLogger(),
+		LineErrorPolicy: conveyor.SkipLine,
+		DeadLetter:      conveyor.NewConcurrentWriter(deadLetters, true),
+	}).WorkContext(ctx)
+
+	assertion.ErrorIs(result.Err, context.Canceled)
+	assertion.NotEmpty(out.String())
+
+	for _, chunkResult := range result.Results {
+		if chunkResult.Chunk.Id == 1 {
+			assertion.True(chunkResult.Ok())
+			assertion.Len(chunkResult.LineErrors, 1)
+		}
+	}
+
+	assertion.Equal(1, strings.Count(deadLetters.String(), "Lorem"))
+}
@@ -0,0 +1,261 @@
+package conveyor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// quoteScanBuffSize is the size of the read buffer of ScanQuotes.
+const quoteScanBuffSize = 64 * 1024
+
+// Delimiter defines the byte sequence that terminates the records of the input.
+// Records are split like a sequential scan of the input splits them, even if
+// two Sequences overlap like in "\n\n\n" for "\n\n". Every record belongs
+// to the chunk that contains its first byte, so it is never split between
+// two chunks.
+type Delimiter struct {
+	// Sequence terminates every record. It is part of the record that is
+	// passed to the LineProcessor, except for the last record of a chunk.
+	Sequence []byte
+
+	// StripCR removes a '\r' directly before the Sequence from every record,
+	// e.g. to process files with CRLF line breaks like files with LF line breaks.
+	StripCR bool
+
+	// Quote enables quote aware splitting if it is not 0. A Sequence between
+	// two Quote characters is part of the record, e.g. a line break in a
+	// quoted CSV field. Escaped quotes are expected to be doubled like in
+	// RFC 4180. Chunks must know whether they start inside quotes, see ScanQuotes.
+	Quote byte
+}
+
+var (
+	// LF separates records by '\n'.
+	LF = Delimiter{Sequence: []byte{'\n'}}
+
+	// CRLF separates records by '\n' and removes the '\r' before it.
+	CRLF = Delimiter{Sequence: []byte{'\n'}, StripCR: true}
+
+	// NUL separates records by '\x00', e.g. the output of find -print0.
+	NUL = Delimiter{Sequence: []byte{0}}
+
+	// CSV separates records by '\n' outside of double quoted fields.
+	CSV = Delimiter{Sequence: []byte{'\n'}, Quote: '"'}
+)
+
+// DefaultDelimiter is used if no Delimiter is set.
+var DefaultDelimiter = LF
+
+// ByteDelimiter returns a Delimiter that separates records by b.
+func ByteDelimiter(b byte) Delimiter {
+	return Delimiter{Sequence: []byte{b}}
+}
+
+// SequenceDelimiter returns a Delimiter that separates records by sequence.
+func SequenceDelimiter(sequence string) Delimiter {
+	return Delimiter{Sequence: []byte(sequence)}
+}
+
+// equal reports whether d and other split records the same way.
+func (d Delimiter) equal(other Delimiter) bool {
+	return bytes.Equal(d.Sequence, other.Sequence) && d.Quote == other.Quote
+}
+
+// orDefault returns DefaultDelimiter if d has no Sequence.
+func (d Delimiter) orDefault() Delimiter {
+	if len(d.Sequence) == 0 {
+		return DefaultDelimiter
+	}
+
+	return d
+}
+
+// ScanQuotes sets Chunk.InQuotes for all chunks by counting the quote
+// characters in front of every chunk, which requires a sequential read of
+// the input. The chunks of every ChunkReader must be ordered by their offsets,
+// like the chunks returned by GetChunksFromFile or PlanChunks.
+// Chunks created by ChunkStream already know their quote state.
+func ScanQuotes(chunks []Chunk, quote byte) error {
+	var (
+		handle   io.ReadSeekCloser
+		handleID string
+		position int64
+		inQuotes bool
+		buff     = make([]byte, quoteScanBuffSize)
+		quotes   = []byte{quote}
+	)
+
+	defer func() {
+		if handle != nil {
+			handle.Close()
+		}
+	}()
+
+	for i := range chunks {
+		chunk := &chunks[i]
+
+		if handle == nil || chunk.In.GetHandleID() != handleID || chunk.Offset < position {
+			if handle != nil {
+				handle.Close()
+			}
+
+			var err error
+			handle, err = chunk.In.OpenHandle()
+			if err != nil {
+				handle = nil
+				return err
+			}
+
+			handleID = chunk.In.GetHandleID()
+			position, inQuotes = 0, false
+		}
+
+		for position < chunk.Offset {
+			size := int64(len(buff))
+			if remaining := chunk.Offset - position; remaining < size {
+				size = remaining
+			}
+
+			n, err := io.ReadFull(handle, buff[:size])
+			if err != nil {
+				return fmt.Errorf("error while scanning quotes of chunk %d: %w", chunk.Id, err)
+			}
+
+			inQuotes = inQuotes != (bytes.Count(buff[:n], quotes)%2 == 1)
+			position += int64(n)
+		}
+
+		chunk.InQuotes = inQuotes
+	}
+
+	return nil
+}
+
+// overlaps reports whether two Sequences can overlap, e.g. "\n\n" in
+// "\n\n\n". A scan for such a Sequence only finds the same delimiters as a
+// scan from the start of the input if it starts outside of a delimiter.
+func (d Delimiter) overlaps() bool {
+	for n := 1; n < len(d.Sequence); n++ {
+		if bytes.Equal(d.Sequence[:n], d.Sequence[len(d.Sequence)-n:]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// syncPoint returns the last index in b, at most len(b)-len(Sequence), at
+// which a scan finds the same delimiters as a scan from the start of the
+// input. synced reports whether a scan can start at the start of b, which
+// is returned if there is no other such index. It returns -1 otherwise.
+func (d Delimiter) syncPoint(b []byte, synced bool) int {
+	size := len(d.Sequence)
+	last := len(b) - size
+
+	switch {
+	case last < 0:
+		if synced {
+			return 0
+		}
+
+		return -1
+	case !d.overlaps():
+		return last
+	}
+
+	// A scan can start at p if no Sequence starts less than
+	// len(Sequence) bytes in front of p.
+	for p := last; p >= size-1; p-- {
+		if bytes.Index(b[p-size+1:p+size-1], d.Sequence) == -1 {
+			return p
+		}
+	}
+
+	if synced {
+		return 0
+	}
+
+	return -1
+}
+
+// boundaryScan returns the index in b from which a scan finds the first
+// delimiter that ends at or after the end of b, and the quote state at that
+// index. start is the start of a record in b, quoted the quote state there.
+func (d Delimiter) boundaryScan(b []byte, start int, quoted bool) (int, bool) {
+	if !d.overlaps() {
+		position := len(b) - len(d.Sequence)
+		if position < start {
+			position = start
+		}
+
+		return position, d.quoted(b[start:position], quoted)
+	}
+
+	// Skip the delimiters in b, since the scan could start inside of
+	// one of them otherwise.
+	for {
+		i := d.index(b[start:], quoted)
+		if i == -1 || start+i+len(d.Sequence) == len(b) {
+			return start, quoted
+		}
+
+		start += i + len(d.Sequence)
+		quoted = false
+	}
+}
+
+// index returns the index of the first Sequence in b that is not enclosed in
+// quotes, or -1 if there is none. quoted is the quote state at the start of b.
+func (d Delimiter) index(b []byte, quoted bool) int {
+	if d.Quote == 0 {
+		return bytes.Index(b, d.Sequence)
+	}
+
+	for offset := 0; offset < len(b); {
+		i := bytes.Index(b[offset:], d.Sequence)
+		if i == -1 {
+			return -1
+		}
+
+		quoted = d.quoted(b[offset:offset+i], quoted)
+		if !quoted {
+			return offset + i
+		}
+
+		// The Sequence is part of a quoted field.
+		quoted = d.quoted(d.Sequence, quoted)
+		offset += i + len(d.Sequence)
+	}
+
+	return -1
+}
+
+// quoted returns the quote state after b, quoted is the quote state before b.
+func (d Delimiter) quoted(b []byte, quoted bool) bool {
+	if d.Quote == 0 {
+		return false
+	}
+
+	return quoted != (bytes.Count(b, []byte{d.Quote})%2 == 1)
+}
+
+// stripCR removes the '\r' before end from record if StripCR is set. end is
+// the index of the Sequence that terminates record.
+func (d Delimiter) stripCR(record []byte, end int) []byte {
+	if !d.StripCR || end == 0 || record[end-1] != '\r' {
+		return record
+	}
+
+	copy(record[end-1:], record[end:])
+	return record[:len(record)-1]
+}
+
+// optionalDelimiter returns the first Delimiter of delimiter or DefaultDelimiter.
+func optionalDelimiter(delimiter []Delimiter) Delimiter {
+	if len(delimiter) > 0 {
+		return delimiter[0].orDefault()
+	}
+
+	return DefaultDelimiter
+}
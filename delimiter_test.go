@@ -0,0 +1,312 @@
+package conveyor_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fgehrlicher/conveyor"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordCollector is a LineProcessor that collects all records it processes.
+type recordCollector struct {
+	records []string
+	sync.Mutex
+}
+
+func (r *recordCollector) Process(line []byte, metadata conveyor.LineMetadata) ([]byte, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.records = append(r.records, string(line))
+	return line, nil
+}
+
+func TestQueueDelimiter(t *testing.T) {
+	assertion := assert.New(t)
+	records := []string{"alpha", "be", "gamma", "d", "epsilon", "zeta", "eta", "theta", "io", "kappa"}
+
+	tt := []struct {
+		Name            string
+		Delimiter       conveyor.Delimiter
+		Input           string
+		ExpectedOutput  string
+		ExpectedRecords []string
+	}{
+		{
+			Name:           "nul",
+			Delimiter:      conveyor.NUL,
+			Input:          strings.Join(records, "\x00") + "\x00",
+			ExpectedOutput: strings.Join(records, "\x00") + "\x00",
+		},
+		{
+			Name:           "multi byte",
+			Delimiter:      conveyor.SequenceDelimiter("<>"),
+			Input:          strings.Join(records, "<>") + "<>",
+			ExpectedOutput: strings.Join(records, "<>") + "<>",
+		},
+		{
+			Name:           "crlf",
+			Delimiter:      conveyor.CRLF,
+			Input:          strings.Join(records, "\r\n") + "\r\n",
+			ExpectedOutput: strings.Join(records, "\n") + "\n",
+		},
+	}
+
+	for _, test := range tt {
+		// Every chunk must contain the start of a delimiter.
+		for chunkSize := 9; chunkSize <= 24; chunkSize++ {
+			for _, workers := range []int{1, 4} {
+				out := &bytes.Buffer{}
+				writer := conveyor.NewConcurrentWriter(out, true, test.Delimiter)
+				collector := &recordCollector{}
+
+				in := &conveyor.StreamReader{Name: test.Name, Data: []byte(test.Input)}
+				chunks, err := conveyor.GetChunksFromReader(in, chunkSize, writer)
+				assertion.NoError(err)
+
+				result := conveyor.NewQueue(chunks, workers, collector, &conveyor.QueueOpts{
+					Delimiter: test.Delimiter,
+					Logger:    NullLogger(),
+					ErrLogger: NullLogger(),
+				}).Work()
+
+				assertion.Empty(result.FailedChunks, "%s: chunk size %d", test.Name, chunkSize)
+				assertion.Equal(int64(len(records)), result.Lines, "%s: chunk size %d", test.Name, chunkSize)
+				assertion.Equal(test.ExpectedOutput, out.String(), "%s: chunk size %d", test.Name, chunkSize)
+
+				for _, record := range collector.records {
+					assertion.NotContains(record, "\r", "%s: chunk size %d", test.Name, chunkSize)
+				}
+			}
+		}
+	}
+}
+
+func TestChunkStreamDelimiter(t *testing.T) {
+	assertion := assert.New(t)
+	stream := "aaaa<>bbbbbb<>ccc<>d"
+
+	var chunks []conveyor.Chunk
+	err := conveyor.ChunkStream(
+		strings.NewReader(stream),
+		"stream",
+		5,
+		1,
+		nil,
+		conveyor.SequenceDelimiter("<>"),
+		func(c ...conveyor.Chunk) error {
+			chunks = append(chunks, c...)
+			return nil
+		},
+	)
+	assertion.NoError(err)
+
+	expectedData := []string{
+		"aaaa<>b",
+		"a<>bbbbbb<>c",
+		"bbbb<>ccc<>d",
+		">ccc<>d",
+	}
+
+	assertion.Len(chunks, len(expectedData))
+	for i, chunk := range chunks {
+		assertion.Equal(expectedData[i], string(chunk.In.(*conveyor.StreamReader).Data))
+	}
+}
+
+// csvRecordValidator is a LineProcessor that fails for every line which
+// is not a single CSV record with the given number of fields.
+type csvRecordValidator struct {
+	fields int
+}
+
+func (c *csvRecordValidator) Process(line []byte, metadata conveyor.LineMetadata) ([]byte, error) {
+	records, err := csv.NewReader(bytes.NewReader(line)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) != 1 || len(records[0]) != c.fields {
+		return nil, fmt.Errorf("invalid record %q", line)
+	}
+
+	return line, nil
+}
+
+func TestQueueQuotedCSV(t *testing.T) {
+	var (
+		assertion     = assert.New(t)
+		testFile      = "testdata/animal_notes.csv"
+		recordsInFile = 101
+	)
+
+	expectedFile, err := ioutil.ReadFile(testFile)
+	assertion.NoError(err)
+
+	for _, chunkSize := range []int{400, 512, 1000, 4096} {
+		for _, workers := range []int{1, 4} {
+			out := &bytes.Buffer{}
+			writer := conveyor.NewConcurrentWriter(out, true, conveyor.CSV)
+
+			chunks, err := conveyor.GetChunksFromFile(testFile, chunkSize, writer)
+			assertion.NoError(err)
+			assertion.NoError(conveyor.ScanQuotes(chunks, '"'))
+
+			result := conveyor.NewQueue(chunks, workers, &csvRecordValidator{fields: 3}, &conveyor.QueueOpts{
+				Delimiter: conveyor.CSV,
+				Logger:    NullLogger(),
+				ErrLogger: NullLogger(),
+			}).Work()
+
+			assertion.Empty(result.FailedChunks, "chunk size %d", chunkSize)
+			assertion.Equal(int64(recordsInFile), result.Lines, "chunk size %d", chunkSize)
+			assertion.Equal(string(expectedFile), out.String(), "chunk size %d", chunkSize)
+		}
+	}
+}
+
+func TestDynamicQueueQuotedCSV(t *testing.T) {
+	var (
+		assertion     = assert.New(t)
+		testFile      = "testdata/animal_notes.csv"
+		recordsInFile = 101
+	)
+
+	expectedFile, err := ioutil.ReadFile(testFile)
+	assertion.NoError(err)
+
+	submitters := map[string]func(queue *conveyor.Queue, out conveyor.ChunkWriter) error{
+		"file": func(queue *conveyor.Queue, out conveyor.ChunkWriter) error {
+			return queue.SubmitFile(testFile, out)
+		},
+		"stream": func(queue *conveyor.Queue, out conveyor.ChunkWriter) error {
+			return queue.SubmitStream(bytes.NewReader(expectedFile), "stream", out)
+		},
+	}
+
+	for name, submit := range submitters {
+		out := &bytes.Buffer{}
+
+		queue := conveyor.NewDynamicQueue(4, 400, &csvRecordValidator{fields: 3}, &conveyor.QueueOpts{
+			Delimiter: conveyor.CSV,
+			Logger:    NullLogger(),
+			ErrLogger: NullLogger(),
+		})
+		queue.Start(context.Background())
+
+		go func() {
+			assertion.NoError(submit(queue, conveyor.NewConcurrentWriter(out, true, conveyor.CSV)))
+			queue.Close()
+		}()
+
+		result := queue.Wait()
+
+		assertion.Empty(result.FailedChunks, name)
+		assertion.Equal(int64(recordsInFile), result.Lines, name)
+		assertion.Equal(string(expectedFile), out.String(), name)
+	}
+}
+
+// lineRecorder is a LineProcessor that records every line by its
+// LineMetadata.AbsoluteLine. It prefixes every line with '#', so even empty
+// lines have an output.
+type lineRecorder struct {
+	lines map[int64]string
+	sync.Mutex
+}
+
+func (l *lineRecorder) Process(line []byte, metadata conveyor.LineMetadata) ([]byte, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.lines[metadata.AbsoluteLine] = string(line)
+	return append([]byte{'#'}, line...), nil
+}
+
+func TestQueueOverlappingDelimiter(t *testing.T) {
+	assertion := assert.New(t)
+
+	tt := []struct {
+		Delimiter string
+		Input     string
+	}{
+		{Delimiter: "aa", Input: "xaaay"},
+		{Delimiter: "aa", Input: "aaaxaaaaybaaaaaazaa"},
+		{Delimiter: "aba", Input: "xababay"},
+		{Delimiter: "aba", Input: "ababababxabaabababyaba"},
+		{Delimiter: "||", Input: "a|||b||||c|||||d|"},
+		{Delimiter: "\n\n", Input: "first\n\n\nsecond\n\n\n\n\nthird\n\n"},
+		{Delimiter: "\n\n", Input: "first" + strings.Repeat("\n", 11) + "second\n\n"},
+	}
+
+	for _, test := range tt {
+		var (
+			delimiter = conveyor.SequenceDelimiter(test.Delimiter)
+			path      = filepath.Join(t.TempDir(), "input")
+			expected  = strings.SplitAfter(test.Input, test.Delimiter)
+		)
+
+		if expected[len(expected)-1] == "" {
+			expected = expected[:len(expected)-1]
+		}
+
+		expectedOutput := "#" + strings.Join(expected, "#")
+
+		assertion.NoError(ioutil.WriteFile(path, []byte(test.Input), 0644))
+
+		submitters := map[string]func(queue *conveyor.Queue, out conveyor.ChunkWriter) error{
+			"file": func(queue *conveyor.Queue, out conveyor.ChunkWriter) error {
+				return queue.SubmitFile(path, out)
+			},
+			"stream": func(queue *conveyor.Queue, out conveyor.ChunkWriter) error {
+				return queue.SubmitStream(strings.NewReader(test.Input), "stream", out)
+			},
+		}
+
+		for chunkSize := 1; chunkSize <= len(test.Input); chunkSize++ {
+			for name, submit := range submitters {
+				var (
+					out      = &bytes.Buffer{}
+					recorder = &lineRecorder{lines: make(map[int64]string)}
+					msg      = fmt.Sprintf("%q in %q, %s, chunk size %d", test.Delimiter, test.Input, name, chunkSize)
+				)
+
+				queue := conveyor.NewDynamicQueue(4, chunkSize, recorder, &conveyor.QueueOpts{
+					Delimiter:   delimiter,
+					NumberLines: true,
+					Logger:      NullLogger(),
+					ErrLogger:   NullLogger(),
+				})
+				queue.Start(context.Background())
+
+				go func() {
+					assertion.NoError(submit(queue, conveyor.NewConcurrentWriter(out, true, delimiter)), msg)
+					queue.Close()
+				}()
+
+				result := queue.Wait()
+
+				assertion.Empty(result.FailedChunks, msg)
+				assertion.Equal(int64(len(expected)), result.Lines, msg)
+				assertion.Equal(expectedOutput, out.String(), msg)
+
+				// The last line of a chunk is passed without its delimiter.
+				for i, line := range expected {
+					assertion.Equal(
+						strings.TrimSuffix(line, test.Delimiter),
+						strings.TrimSuffix(recorder.lines[int64(i+1)], test.Delimiter),
+						msg,
+					)
+				}
+			}
+		}
+	}
+}
@@ -1,10 +1,9 @@
 package main
 
 import (
+	"encoding/csv"
 	"fmt"
-	"io"
 	"os"
-	"strings"
 	"sync"
 
 	"github.com/fgehrlicher/conveyor"
@@ -15,10 +14,11 @@ const (
 	chunkSize     = 512
 	workerCount   = 4
 
-	header         = "id,name,scientific_name"
-	sortFieldIndex = 3
+	sortField = "code"
 )
 
+var header = []string{"id", "name", "scientific_name"}
+
 func main() {
 	// Get Chunks from animals.csv
 	chunks, err := conveyor.GetChunksFromFile(inputFilePath, chunkSize, nil)
@@ -26,6 +26,7 @@ func main() {
 
 	// Run Queue
 	result := conveyor.NewQueue(chunks, workerCount, NewAnimalSorter()).Work()
+	checkErr(result.Err)
 
 	// Print results
 	fmt.Printf(
@@ -35,54 +36,77 @@ func main() {
 	)
 }
 
+// AnimalSorter writes every animal to the file of its sortField.
+// The files are closed once the Queue is done.
 type AnimalSorter struct {
-	handles map[string]io.Writer
+	*conveyor.CSVProcessor
+
+	files   map[string]*os.File
+	handles map[string]*csv.Writer
 
 	sync.Mutex
 }
 
 func NewAnimalSorter() *AnimalSorter {
-	return &AnimalSorter{
-		handles: make(map[string]io.Writer),
+	c := &AnimalSorter{
+		files:   make(map[string]*os.File),
+		handles: make(map[string]*csv.Writer),
 	}
+	c.CSVProcessor = conveyor.NewCSVProcessor(c.Sort)
+
+	return c
 }
 
-func (c *AnimalSorter) Process(line []byte, _ conveyor.LineMetadata) ([]byte, error) {
+func (c *AnimalSorter) Sort(record *conveyor.CSVRecord, _ conveyor.LineMetadata) (*conveyor.CSVRecord, error) {
 	c.Lock()
 	defer c.Unlock()
 
-	// get row slice
-	row := strings.Split(strings.TrimSuffix(string(line), "\n"), ",")
-
 	// get sortField
-	sortField := row[sortFieldIndex]
-
-	// Early return if row is header
-	if sortField == "code" {
-		return nil, nil
-	}
+	sortValue := record.Get(sortField)
 
 	// create handle if sortField handle does not exist yet
-	handle, ok := c.handles[sortField]
+	handle, ok := c.handles[sortValue]
 	if !ok {
-		var err error
-		handle, err = os.Create(fmt.Sprintf("out/%s-animals.csv", sortField))
+		file, err := os.Create(fmt.Sprintf("out/%s-animals.csv", sortValue))
 		checkErr(err)
 
-		_, err = handle.Write([]byte(header + "\n"))
-		checkErr(err)
+		handle = csv.NewWriter(file)
+		checkErr(handle.Write(header))
 
-		c.handles[sortField] = handle
+		c.files[sortValue] = file
+		c.handles[sortValue] = handle
 	}
 
 	// write result to sortField handle
-	resultRow := []byte(strings.Join(row[:sortFieldIndex], ",") + "\n")
-	_, err := handle.Write(resultRow)
-	checkErr(err)
+	resultRow := make([]string, 0, len(header))
+	for _, column := range header {
+		resultRow = append(resultRow, record.Get(column))
+	}
+
+	checkErr(handle.Write(resultRow))
 
 	return nil, nil
 }
 
+// OnQueueDone flushes and closes all files.
+func (c *AnimalSorter) OnQueueDone(conveyor.QueueResult) error {
+	c.Lock()
+	defer c.Unlock()
+
+	for sortValue, handle := range c.handles {
+		handle.Flush()
+		if err := handle.Error(); err != nil {
+			return err
+		}
+
+		if err := c.files[sortValue].Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func checkErr(err error) {
 	if err != nil {
 		panic(err)
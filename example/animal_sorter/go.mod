@@ -4,6 +4,4 @@ go 1.15
 
 replace github.com/fgehrlicher/conveyor => ../..
 
-require (
-	github.com/fgehrlicher/conveyor v1.0.0
-)
\ No newline at end of file
+require github.com/fgehrlicher/conveyor v1.0.0
@@ -1,9 +1,9 @@
 module github.com/fgehrlicher/conveyor/example/rune_counter
 
-go 1.15
+go 1.18
 
 replace github.com/fgehrlicher/conveyor => ../..
 
-require (
-	github.com/fgehrlicher/conveyor v1.0.0
-)
\ No newline at end of file
+require github.com/fgehrlicher/conveyor v1.0.0
+
+require github.com/klauspost/compress v1.13.6 // indirect
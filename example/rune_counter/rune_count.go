@@ -1,10 +1,9 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"log"
-	"strings"
-	"sync"
 
 	"github.com/fgehrlicher/conveyor"
 )
@@ -27,42 +26,37 @@ func main() {
 	)
 }
 
+// RuneCounter counts the occurrences of runes. Every chunk is counted into
+// its own Histogram, which is merged once the chunk succeeded.
 type RuneCounter struct {
-	runes  []rune
-	result map[rune]int
+	*conveyor.Aggregator[rune, conveyor.Histogram[rune]]
 
-	sync.Mutex
+	runes []rune
 }
 
 func NewRuneCounter(runes []rune) *RuneCounter {
-	result := make(map[rune]int)
-	for _, s := range runes {
-		result[s] = 0
-	}
+	c := &RuneCounter{runes: runes}
+	c.Aggregator = conveyor.NewAggregator(c.extract, conveyor.HistogramReducer[rune]())
 
-	return &RuneCounter{
-		runes:  runes,
-		result: result,
-	}
+	return c
 }
 
-func (c *RuneCounter) Process(line []byte, _ conveyor.LineMetadata) ([]byte, error) {
+func (c *RuneCounter) extract(line []byte, _ conveyor.LineMetadata, emit func(rune)) error {
 	for _, r := range c.runes {
-		if count := strings.Count(string(line), string(r)); count > 0 {
-			c.Lock()
-			c.result[r] += count
-			c.Unlock()
+		for count := bytes.Count(line, []byte(string(r))); count > 0; count-- {
+			emit(r)
 		}
 	}
 
-	return nil, nil
+	return nil
 }
 
 func (c *RuneCounter) Result() string {
 	result := fmt.Sprint("Found occurrences of runes: \n")
+	counts := c.Aggregator.Result()
 
-	for r, count := range c.result {
-		result += fmt.Sprintf("%q: %d \n", r, count)
+	for _, r := range c.runes {
+		result += fmt.Sprintf("%q: %d \n", r, counts[r])
 	}
 
 	return result
@@ -0,0 +1,54 @@
+package conveyor
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTooManyFailures is returned by the builtin FailurePolicy implementations
+// once they abort a Queue run.
+var ErrTooManyFailures = errors.New("too many failed chunks")
+
+// The FailurePolicy type decides after every processed chunk whether the
+// Queue run should be aborted. A non nil error aborts the run and is
+// reported as QueueResult.Err.
+type FailurePolicy func(failedChunks, processedChunks, totalChunks int) error
+
+// FailFast returns a FailurePolicy that aborts the run on the first failed chunk.
+func FailFast() FailurePolicy {
+	return MaxFailures(1)
+}
+
+// MaxFailures returns a FailurePolicy that aborts the run once n chunks failed.
+func MaxFailures(n int) FailurePolicy {
+	return func(failedChunks, processedChunks, totalChunks int) error {
+		if failedChunks >= n {
+			return fmt.Errorf("%w: %d of %d chunks failed", ErrTooManyFailures, failedChunks, processedChunks)
+		}
+
+		return nil
+	}
+}
+
+// MaxFailureRatio returns a FailurePolicy that aborts the run once the ratio of
+// failed to processed chunks exceeds ratio. The ratio is only checked after
+// at least minChunks chunks were processed, so a single early failure does
+// not abort the run.
+func MaxFailureRatio(ratio float64, minChunks int) FailurePolicy {
+	return func(failedChunks, processedChunks, totalChunks int) error {
+		if processedChunks == 0 || processedChunks < minChunks {
+			return nil
+		}
+
+		if current := float64(failedChunks) / float64(processedChunks); current > ratio {
+			return fmt.Errorf(
+				"%w: failure ratio %.2f exceeds %.2f",
+				ErrTooManyFailures,
+				current,
+				ratio,
+			)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,57 @@
+package conveyor_test
+
+import (
+	"testing"
+
+	"github.com/fgehrlicher/conveyor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailurePolicies(t *testing.T) {
+	assertion := assert.New(t)
+
+	tt := []struct {
+		Policy          conveyor.FailurePolicy
+		FailedChunks    int
+		ProcessedChunks int
+		ExpectAbort     bool
+	}{
+		{Policy: conveyor.FailFast(), FailedChunks: 0, ProcessedChunks: 10},
+		{Policy: conveyor.FailFast(), FailedChunks: 1, ProcessedChunks: 1, ExpectAbort: true},
+		{Policy: conveyor.MaxFailures(3), FailedChunks: 2, ProcessedChunks: 2},
+		{Policy: conveyor.MaxFailures(3), FailedChunks: 3, ProcessedChunks: 5, ExpectAbort: true},
+		{Policy: conveyor.MaxFailureRatio(0.5, 4), FailedChunks: 3, ProcessedChunks: 3},
+		{Policy: conveyor.MaxFailureRatio(0.5, 4), FailedChunks: 2, ProcessedChunks: 4},
+		{Policy: conveyor.MaxFailureRatio(0.5, 4), FailedChunks: 3, ProcessedChunks: 4, ExpectAbort: true},
+	}
+
+	for _, test := range tt {
+		err := test.Policy(test.FailedChunks, test.ProcessedChunks, 10)
+
+		if test.ExpectAbort {
+			assertion.ErrorIs(err, conveyor.ErrTooManyFailures)
+		} else {
+			assertion.NoError(err)
+		}
+	}
+}
+
+func TestQueueAbortsOnFailurePolicy(t *testing.T) {
+	assertion := assert.New(t)
+	chunks := 10
+
+	result := conveyor.NewQueue(
+		generateTestChunks(chunks, 100, "non_existing_file"),
+		1,
+		nil,
+		&conveyor.QueueOpts{
+			ErrLogger:     NullLogger(),
+			FailurePolicy: conveyor.FailFast(),
+		},
+	).Work()
+
+	assertion.ErrorIs(result.Err, conveyor.ErrTooManyFailures)
+	assertion.NotEmpty(result.UnprocessedChunks)
+	assertion.Equal(chunks, result.FailedChunks+result.UnprocessedChunks)
+	assertion.Equal(chunks, len(result.Results))
+}
@@ -0,0 +1,331 @@
+package conveyor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// ErrNotSeekable is returned by OpenFrameReader if a compressed file does not
+// consist of independently compressed and indexed frames.
+var ErrNotSeekable = errors.New("compressed file is not seekable")
+
+const (
+	zstdSkippableMagic = 0x184D2A5E
+	zstdSeekableMagic  = 0x8F92EAB1
+	zstdSeekableFooter = 9
+)
+
+// FrameReader is a ChunkReader for compressed files that consist of
+// independently compressed frames: BGZF files (blocked gzip, as written by
+// bgzip) and zstd files in the seekable format. The offsets of the chunks
+// refer to the decompressed data. Every handle only decompresses the frames
+// that are needed for the requested offset, so the chunks can be processed
+// in parallel.
+type FrameReader struct {
+	FilePath    string
+	Compression Compression
+
+	frames []frame
+	size   int64
+}
+
+// frame is a single independently compressed frame.
+// offset and size refer to the decompressed data.
+type frame struct {
+	compressedOffset int64
+	offset           int64
+	size             int64
+}
+
+// OpenFrameReader reads the frame index of the compressed file at path.
+// The format is detected by the file extension.
+func OpenFrameReader(path string) (*FrameReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := &FrameReader{
+		FilePath:    path,
+		Compression: CompressionFromPath(path),
+	}
+
+	switch reader.Compression {
+	case Gzip:
+		reader.frames, err = readBGZFFrames(file)
+	case Zstd:
+		reader.frames, err = readSeekableZstdFrames(file)
+	default:
+		err = fmt.Errorf("%w: %s", ErrNotSeekable, path)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(reader.frames) > 0 {
+		last := reader.frames[len(reader.frames)-1]
+		reader.size = last.offset + last.size
+	}
+
+	return reader, nil
+}
+
+// Size returns the size of the decompressed data.
+func (f *FrameReader) Size() int64 {
+	return f.size
+}
+
+// OpenHandle opens the compressed file and returns a handle
+// that reads and seeks in the decompressed data.
+func (f *FrameReader) OpenHandle() (io.ReadSeekCloser, error) {
+	file, err := os.Open(f.FilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &frameHandle{reader: f, file: file}, nil
+}
+
+// GetHandleID returns the file path which can be used as
+// unique ID across multiple handles.
+func (f *FrameReader) GetHandleID() string {
+	return f.FilePath
+}
+
+// frameIndex returns the index of the frame that contains offset.
+func (f *FrameReader) frameIndex(offset int64) int {
+	return sort.Search(len(f.frames), func(i int) bool {
+		return f.frames[i].offset+f.frames[i].size > offset
+	})
+}
+
+// frameHandle reads the decompressed data of a FrameReader. The decoder is
+// only created on the first Read after a Seek, starting at the frame that
+// contains the position.
+type frameHandle struct {
+	reader   *FrameReader
+	file     *os.File
+	decoder  io.ReadCloser
+	position int64
+}
+
+func (f *frameHandle) Read(p []byte) (int, error) {
+	if f.position >= f.reader.size {
+		return 0, io.EOF
+	}
+
+	if f.decoder == nil {
+		if err := f.openDecoder(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.decoder.Read(p)
+	f.position += int64(n)
+
+	return n, err
+}
+
+func (f *frameHandle) openDecoder() error {
+	current := f.reader.frames[f.reader.frameIndex(f.position)]
+
+	if _, err := f.file.Seek(current.compressedOffset, io.SeekStart); err != nil {
+		return err
+	}
+
+	decoder, err := NewDecompressor(f.file, f.reader.Compression)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.CopyN(ioutil.Discard, decoder, f.position-current.offset); err != nil {
+		decoder.Close()
+		return err
+	}
+
+	f.decoder = decoder
+	return nil
+}
+
+func (f *frameHandle) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.position
+	case io.SeekEnd:
+		offset += f.reader.size
+	}
+
+	if offset < 0 {
+		return 0, fmt.Errorf("invalid offset %d", offset)
+	}
+
+	if offset != f.position {
+		f.closeDecoder()
+		f.position = offset
+	}
+
+	return offset, nil
+}
+
+func (f *frameHandle) Close() error {
+	f.closeDecoder()
+	return f.file.Close()
+}
+
+func (f *frameHandle) closeDecoder() {
+	if f.decoder != nil {
+		f.decoder.Close()
+		f.decoder = nil
+	}
+}
+
+// readBGZFFrames reads the block index of a BGZF file. Every block is a gzip
+// member with a "BC" extra subfield that contains the block size.
+func readBGZFFrames(file *os.File) ([]frame, error) {
+	var (
+		frames           []frame
+		header           = make([]byte, 12)
+		isize            = make([]byte, 4)
+		compressedOffset int64
+		offset           int64
+	)
+
+	for {
+		n, err := file.ReadAt(header, compressedOffset)
+		if n == 0 && err == io.EOF {
+			return frames, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if header[0] != 31 || header[1] != 139 || header[3]&4 == 0 {
+			return nil, fmt.Errorf("%w: %s has no BGZF block at %d", ErrNotSeekable, file.Name(), compressedOffset)
+		}
+
+		extra := make([]byte, binary.LittleEndian.Uint16(header[10:12]))
+		if _, err = file.ReadAt(extra, compressedOffset+12); err != nil {
+			return nil, err
+		}
+
+		blockSize, ok := bgzfBlockSize(extra)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s has no BGZF block at %d", ErrNotSeekable, file.Name(), compressedOffset)
+		}
+
+		if _, err = file.ReadAt(isize, compressedOffset+blockSize-4); err != nil {
+			return nil, err
+		}
+
+		size := int64(binary.LittleEndian.Uint32(isize))
+		if size > 0 {
+			frames = append(frames, frame{
+				compressedOffset: compressedOffset,
+				offset:           offset,
+				size:             size,
+			})
+		}
+
+		compressedOffset += blockSize
+		offset += size
+	}
+}
+
+// bgzfBlockSize returns the total block size stored in the "BC" subfield.
+func bgzfBlockSize(extra []byte) (int64, bool) {
+	for len(extra) >= 4 {
+		length := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if len(extra) < 4+length {
+			return 0, false
+		}
+
+		if extra[0] == 'B' && extra[1] == 'C' && length == 2 {
+			return int64(binary.LittleEndian.Uint16(extra[4:6])) + 1, true
+		}
+
+		extra = extra[4+length:]
+	}
+
+	return 0, false
+}
+
+// readSeekableZstdFrames reads the seek table at the end of a zstd file in
+// the seekable format.
+func readSeekableZstdFrames(file *os.File) ([]frame, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	notSeekable := fmt.Errorf("%w: %s has no zstd seek table", ErrNotSeekable, file.Name())
+
+	if info.Size() < 8+zstdSeekableFooter {
+		return nil, notSeekable
+	}
+
+	footer := make([]byte, zstdSeekableFooter)
+	if _, err = file.ReadAt(footer, info.Size()-zstdSeekableFooter); err != nil {
+		return nil, err
+	}
+
+	if binary.LittleEndian.Uint32(footer[5:9]) != zstdSeekableMagic {
+		return nil, notSeekable
+	}
+
+	var (
+		frameCount = int64(binary.LittleEndian.Uint32(footer[0:4]))
+		entrySize  = int64(8)
+	)
+
+	if footer[4]&0x80 != 0 {
+		entrySize += 4
+	}
+
+	tableSize := frameCount * entrySize
+	tableStart := info.Size() - zstdSeekableFooter - tableSize
+	if tableStart < 8 {
+		return nil, notSeekable
+	}
+
+	table := make([]byte, 8+tableSize)
+	if _, err = file.ReadAt(table, tableStart-8); err != nil {
+		return nil, err
+	}
+
+	if binary.LittleEndian.Uint32(table[0:4]) != zstdSkippableMagic ||
+		int64(binary.LittleEndian.Uint32(table[4:8])) != tableSize+zstdSeekableFooter {
+		return nil, notSeekable
+	}
+
+	var (
+		frames           []frame
+		compressedOffset int64
+		offset           int64
+	)
+
+	for entry := table[8:]; len(entry) > 0; entry = entry[entrySize:] {
+		compressedSize := int64(binary.LittleEndian.Uint32(entry[0:4]))
+		size := int64(binary.LittleEndian.Uint32(entry[4:8]))
+
+		if size > 0 {
+			frames = append(frames, frame{
+				compressedOffset: compressedOffset,
+				offset:           offset,
+				size:             size,
+			})
+		}
+
+		compressedOffset += compressedSize
+		offset += size
+	}
+
+	return frames, nil
+}
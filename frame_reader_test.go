@@ -0,0 +1,228 @@
+package conveyor_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/fgehrlicher/conveyor"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeBGZF writes data as BGZF file with blocks of blockSize uncompressed bytes.
+func writeBGZF(t *testing.T, path string, data []byte, blockSize int) {
+	var out bytes.Buffer
+
+	writeBlock := func(block []byte) {
+		var member bytes.Buffer
+
+		writer := gzip.NewWriter(&member)
+		writer.Extra = []byte{'B', 'C', 2, 0, 0, 0}
+		_, err := writer.Write(block)
+		assert.NoError(t, err)
+		assert.NoError(t, writer.Close())
+
+		blockBytes := member.Bytes()
+		binary.LittleEndian.PutUint16(blockBytes[16:18], uint16(len(blockBytes)-1))
+		out.Write(blockBytes)
+	}
+
+	for len(data) > 0 {
+		size := blockSize
+		if size > len(data) {
+			size = len(data)
+		}
+
+		writeBlock(data[:size])
+		data = data[size:]
+	}
+
+	writeBlock(nil)
+	assert.NoError(t, ioutil.WriteFile(path, out.Bytes(), 0644))
+}
+
+// writeSeekableZstd writes data as zstd file in the seekable format with
+// frames of frameSize uncompressed bytes.
+func writeSeekableZstd(t *testing.T, path string, data []byte, frameSize int) {
+	var (
+		out     bytes.Buffer
+		entries bytes.Buffer
+		frames  uint32
+	)
+
+	encoder, err := zstd.NewWriter(nil)
+	assert.NoError(t, err)
+
+	for len(data) > 0 {
+		size := frameSize
+		if size > len(data) {
+			size = len(data)
+		}
+
+		compressed := encoder.EncodeAll(data[:size], nil)
+		out.Write(compressed)
+
+		entry := make([]byte, 8)
+		binary.LittleEndian.PutUint32(entry[0:4], uint32(len(compressed)))
+		binary.LittleEndian.PutUint32(entry[4:8], uint32(size))
+		entries.Write(entry)
+
+		frames++
+		data = data[size:]
+	}
+
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint32(header[0:4], 0x184D2A5E)
+	binary.LittleEndian.PutUint32(header[4:8], uint32(entries.Len()+9))
+
+	footer := make([]byte, 9)
+	binary.LittleEndian.PutUint32(footer[0:4], frames)
+	binary.LittleEndian.PutUint32(footer[5:9], 0x8F92EAB1)
+
+	out.Write(header)
+	out.Write(entries.Bytes())
+	out.Write(footer)
+
+	assert.NoError(t, ioutil.WriteFile(path, out.Bytes(), 0644))
+}
+
+// writeCompressedTestFiles writes testdata/data.txt in all supported formats
+// and returns the paths.
+func writeCompressedTestFiles(t *testing.T) map[string]string {
+	dir := t.TempDir()
+	data, err := ioutil.ReadFile("testdata/data.txt")
+	assert.NoError(t, err)
+
+	paths := map[string]string{
+		"gzip":          filepath.Join(dir, "data.txt.gz"),
+		"bgzf":          filepath.Join(dir, "data.txt.bgz"),
+		"zstd":          filepath.Join(dir, "data.txt.zst"),
+		"seekable zstd": filepath.Join(dir, "data.seekable.zst"),
+		"bzip2":         "testdata/data.txt.bz2",
+	}
+
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	_, err = gzipWriter.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, gzipWriter.Close())
+	assert.NoError(t, ioutil.WriteFile(paths["gzip"], gzipped.Bytes(), 0644))
+
+	encoder, err := zstd.NewWriter(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(paths["zstd"], encoder.EncodeAll(data, nil), 0644))
+
+	writeBGZF(t, paths["bgzf"], data, 1000)
+	writeSeekableZstd(t, paths["seekable zstd"], data, 1000)
+
+	return paths
+}
+
+func TestFrameReaderReadsAtOffsets(t *testing.T) {
+	assertion := assert.New(t)
+	paths := writeCompressedTestFiles(t)
+
+	data, err := ioutil.ReadFile("testdata/data.txt")
+	assertion.NoError(err)
+
+	for _, format := range []string{"bgzf", "seekable zstd"} {
+		reader, err := conveyor.OpenFrameReader(paths[format])
+		assertion.NoError(err)
+		assertion.Equal(int64(len(data)), reader.Size())
+
+		handle, err := reader.OpenHandle()
+		assertion.NoError(err)
+
+		for _, offset := range []int64{3000, 0, 999, 1000, 6000, 1500} {
+			position, err := handle.Seek(offset, io.SeekStart)
+			assertion.NoError(err)
+			assertion.Equal(offset, position)
+
+			buff := make([]byte, 700)
+			n, err := io.ReadFull(handle, buff)
+			assertion.NoError(err)
+			assertion.Equal(data[offset:offset+int64(n)], buff[:n], format)
+		}
+
+		size, err := handle.Seek(0, io.SeekEnd)
+		assertion.NoError(err)
+		assertion.Equal(int64(len(data)), size)
+
+		assertion.NoError(handle.Close())
+	}
+}
+
+func TestOpenFrameReaderFailsForNotSeekableFiles(t *testing.T) {
+	assertion := assert.New(t)
+	paths := writeCompressedTestFiles(t)
+
+	for _, format := range []string{"gzip", "zstd", "bzip2"} {
+		_, err := conveyor.OpenFrameReader(paths[format])
+		assertion.ErrorIs(err, conveyor.ErrNotSeekable, format)
+	}
+}
+
+func TestQueueProcessesCompressedFiles(t *testing.T) {
+	assertion := assert.New(t)
+	paths := writeCompressedTestFiles(t)
+
+	expectedFile, err := ioutil.ReadFile("testdata/converted_data.txt")
+	assertion.NoError(err)
+
+	for format, path := range paths {
+		buff := &bytes.Buffer{}
+
+		queue := conveyor.NewDynamicQueue(
+			4,
+			512,
+			conveyor.LineProcessorFunc(Redact),
+			&conveyor.QueueOpts{
+				Logger:    NullLogger(),
+				ErrLogger: NullLogger(),
+			},
+		)
+
+		queue.Start(context.Background())
+		assertion.NoError(queue.SubmitFile(path, conveyor.NewConcurrentWriter(buff, true)), format)
+		queue.Close()
+
+		result := queue.Wait()
+		assertion.Empty(result.FailedChunks, format)
+		assertion.Equal(int64(100), result.Lines, format)
+		assertion.Equal(string(expectedFile), buff.String(), format)
+	}
+}
+
+func TestQueueProcessesFrameReaderChunks(t *testing.T) {
+	assertion := assert.New(t)
+	paths := writeCompressedTestFiles(t)
+
+	expectedFile, err := ioutil.ReadFile("testdata/converted_data.txt")
+	assertion.NoError(err)
+
+	reader, err := conveyor.OpenFrameReader(paths["bgzf"])
+	assertion.NoError(err)
+
+	buff := &bytes.Buffer{}
+	chunks, err := conveyor.GetChunksFromReader(reader, 512, conveyor.NewConcurrentWriter(buff, true))
+	assertion.NoError(err)
+
+	result := conveyor.NewQueue(
+		chunks,
+		4,
+		conveyor.LineProcessorFunc(Redact),
+		&conveyor.QueueOpts{
+			Logger:    NullLogger(),
+			ErrLogger: NullLogger(),
+		},
+	).Work()
+
+	assertion.Empty(result.FailedChunks)
+	assertion.Equal(string(expectedFile), buff.String())
+}
@@ -0,0 +1,72 @@
+package conveyor
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ChunkStartHook is an optional interface of LineProcessor and ChunkWriter.
+// OnChunkStart is called by the Worker before the first line of every chunk.
+// An error fails the chunk without processing any line.
+type ChunkStartHook interface {
+	OnChunkStart(chunk Chunk) error
+}
+
+// ChunkEndHook is an optional interface of LineProcessor and ChunkWriter.
+// OnChunkEnd is called by the Worker for every chunk OnChunkStart was called
+// for, once all lines are processed or the processing failed, see
+// ChunkResult.Err. It is guaranteed to run before the output of the chunk is
+// written, so ChunkResult.OutSize is not set yet. An error fails the chunk
+// and its output is not written.
+type ChunkEndHook interface {
+	OnChunkEnd(result ChunkResult) error
+}
+
+// QueueDoneHook is an optional interface of LineProcessor and ChunkWriter.
+// OnQueueDone is called by the Queue once all chunks are done and before
+// Queue.Work or Queue.Wait return. Like for Queue.Wait, QueueResult.Results
+// is empty. It is called once for the LineProcessor of the Queue and once
+// for every distinct ChunkWriter of its chunks. An error is set as
+// QueueResult.Err, unless the run already failed.
+type QueueDoneHook interface {
+	OnQueueDone(result QueueResult) error
+}
+
+// queueDoneHooks collects the distinct QueueDoneHook of the LineProcessor
+// and the ChunkWriters of a Queue. ChunkWriters of types that are not
+// comparable can not be told apart and are skipped.
+type queueDoneHooks struct {
+	hooks []QueueDoneHook
+	seen  map[interface{}]struct{}
+}
+
+func (q *queueDoneHooks) add(v interface{}) {
+	hook, ok := v.(QueueDoneHook)
+	if !ok || !reflect.TypeOf(v).Comparable() {
+		return
+	}
+
+	if q.seen == nil {
+		q.seen = make(map[interface{}]struct{})
+	}
+
+	if _, ok = q.seen[v]; ok {
+		return
+	}
+
+	q.seen[v] = struct{}{}
+	q.hooks = append(q.hooks, hook)
+}
+
+// call calls all hooks and returns the first error.
+func (q *queueDoneHooks) call(result QueueResult) error {
+	var firstErr error
+
+	for _, hook := range q.hooks {
+		if err := hook.OnQueueDone(result); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error in queue done hook: %w", err)
+		}
+	}
+
+	return firstErr
+}
@@ -0,0 +1,220 @@
+package conveyor_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/fgehrlicher/conveyor"
+	"github.com/stretchr/testify/assert"
+)
+
+// hookRecorder records the calls of all hooks. As LineProcessor it adds a line
+// with the chunk id and the number of lines at the end of every chunk.
+type hookRecorder struct {
+	sync.Mutex
+	events      []string
+	started     map[int]bool
+	lines       map[int]int
+	chunkEndErr error
+	queueResult *conveyor.QueueResult
+	queueErr    error
+}
+
+func newHookRecorder() *hookRecorder {
+	return &hookRecorder{
+		started: make(map[int]bool),
+		lines:   make(map[int]int),
+	}
+}
+
+func (h *hookRecorder) record(event string) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.events = append(h.events, event)
+}
+
+func (h *hookRecorder) Process(line []byte, metadata conveyor.LineMetadata) ([]byte, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	if !h.started[metadata.Chunk.Id] {
+		return nil, errors.New("line processed before chunk start")
+	}
+
+	h.lines[metadata.Chunk.Id]++
+	return line, nil
+}
+
+func (h *hookRecorder) OnChunkStart(chunk conveyor.Chunk) error {
+	h.Lock()
+	defer h.Unlock()
+
+	h.started[chunk.Id] = true
+	h.events = append(h.events, fmt.Sprintf("start %d", chunk.Id))
+
+	return nil
+}
+
+func (h *hookRecorder) OnChunkEnd(result conveyor.ChunkResult) error {
+	h.Lock()
+	defer h.Unlock()
+
+	if result.Lines != h.lines[result.Chunk.Id] {
+		return fmt.Errorf("chunk %d: result has %d lines, processed %d", result.Chunk.Id, result.Lines, h.lines[result.Chunk.Id])
+	}
+
+	h.events = append(h.events, fmt.Sprintf("end %d", result.Chunk.Id))
+	return h.chunkEndErr
+}
+
+func (h *hookRecorder) OnQueueDone(result conveyor.QueueResult) error {
+	h.Lock()
+	defer h.Unlock()
+
+	h.queueResult = &result
+	h.events = append(h.events, "done")
+
+	return h.queueErr
+}
+
+// hookWriter records the order of the hooks and writes of a ChunkWriter.
+type hookWriter struct {
+	*hookRecorder
+}
+
+func (h hookWriter) Write(chunk *conveyor.Chunk, buff []byte) error {
+	h.record(fmt.Sprintf("write %d", chunk.Id))
+	return nil
+}
+
+func (h hookWriter) OnChunkStart(chunk conveyor.Chunk) error {
+	h.record(fmt.Sprintf("writer start %d", chunk.Id))
+	return nil
+}
+
+func (h hookWriter) OnChunkEnd(result conveyor.ChunkResult) error {
+	h.record(fmt.Sprintf("writer end %d", result.Chunk.Id))
+	return nil
+}
+
+func (h hookWriter) OnQueueDone(conveyor.QueueResult) error {
+	h.record("writer done")
+	return nil
+}
+
+func TestHooks(t *testing.T) {
+	assertion := assert.New(t)
+
+	recorder := newHookRecorder()
+	writer := hookWriter{newHookRecorder()}
+
+	chunks, err := conveyor.GetChunksFromFile("testdata/data.txt", 2048, writer)
+	assertion.NoError(err)
+
+	result := conveyor.NewQueue(chunks, 1, recorder, &conveyor.QueueOpts{
+		Logger:    NullLogger(),
+		ErrLogger: NullLogger(),
+	}).Work()
+
+	assertion.NoError(result.Err)
+	assertion.Empty(result.FailedChunks)
+
+	var expectedEvents, expectedWriterEvents []string
+	for _, chunk := range chunks {
+		expectedEvents = append(expectedEvents, fmt.Sprintf("start %d", chunk.Id), fmt.Sprintf("end %d", chunk.Id))
+		expectedWriterEvents = append(
+			expectedWriterEvents,
+			fmt.Sprintf("writer start %d", chunk.Id),
+			fmt.Sprintf("writer end %d", chunk.Id),
+			fmt.Sprintf("write %d", chunk.Id),
+		)
+	}
+
+	assertion.Equal(append(expectedEvents, "done"), recorder.events)
+	assertion.Equal(append(expectedWriterEvents, "writer done"), writer.events)
+
+	assertion.NotNil(recorder.queueResult)
+	assertion.Equal(result.Lines, recorder.queueResult.Lines)
+	assertion.Empty(recorder.queueResult.Results)
+}
+
+func TestHooksErrors(t *testing.T) {
+	assertion := assert.New(t)
+	hookErr := errors.New("hook error")
+
+	recorder := newHookRecorder()
+	recorder.chunkEndErr = hookErr
+	recorder.queueErr = hookErr
+
+	out := &bytes.Buffer{}
+	chunks, err := conveyor.GetChunksFromFile("testdata/data.txt", 2048, conveyor.NewConcurrentWriter(out, false))
+	assertion.NoError(err)
+
+	result := conveyor.NewQueue(chunks, 4, recorder, &conveyor.QueueOpts{
+		Logger:    NullLogger(),
+		ErrLogger: NullLogger(),
+	}).Work()
+
+	assertion.ErrorIs(result.Err, hookErr)
+	assertion.Equal(len(chunks), result.FailedChunks)
+	assertion.Empty(out.String())
+
+	for _, chunkResult := range result.Results {
+		assertion.ErrorIs(chunkResult.Err, hookErr)
+	}
+}
+
+// panickingRecorder is a hookRecorder whose LineProcessor panics for the
+// lines of one chunk.
+type panickingRecorder struct {
+	*hookRecorder
+	chunkId int
+}
+
+func (p panickingRecorder) Process(line []byte, metadata conveyor.LineMetadata) ([]byte, error) {
+	if metadata.Chunk.Id == p.chunkId {
+		panic("processor panic")
+	}
+
+	return p.hookRecorder.Process(line, metadata)
+}
+
+func TestHooksPanic(t *testing.T) {
+	assertion := assert.New(t)
+
+	recorder := panickingRecorder{newHookRecorder(), 2}
+	writer := hookWriter{newHookRecorder()}
+
+	chunks, err := conveyor.GetChunksFromFile("testdata/data.txt", 2048, writer)
+	assertion.NoError(err)
+
+	result := conveyor.NewQueue(chunks, 1, recorder, &conveyor.QueueOpts{
+		Logger:    NullLogger(),
+		ErrLogger: NullLogger(),
+	}).Work()
+
+	assertion.Equal(1, result.FailedChunks)
+
+	var panicErr *conveyor.PanicError
+	for _, chunkResult := range result.Results {
+		if chunkResult.Chunk.Id == recorder.chunkId {
+			assertion.ErrorAs(chunkResult.Err, &panicErr)
+		}
+	}
+	assertion.NotNil(panicErr)
+
+	var expectedEvents []string
+	for _, chunk := range chunks {
+		expectedEvents = append(expectedEvents, fmt.Sprintf("start %d", chunk.Id), fmt.Sprintf("end %d", chunk.Id))
+	}
+
+	assertion.Equal(append(expectedEvents, "done"), recorder.events)
+
+	for _, chunk := range chunks {
+		assertion.Contains(writer.events, fmt.Sprintf("writer end %d", chunk.Id))
+	}
+}
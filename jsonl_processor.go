@@ -0,0 +1,209 @@
+package conveyor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrInvalidJSON is returned by JSONLProcessor for lines that can not be
+	// decoded. Like every other error of a LineProcessor it is handled by
+	// the LineErrorPolicy.
+	ErrInvalidJSON = errors.New("invalid json")
+
+	// ErrMultipleValues is returned by JSONLProcessor for lines that contain
+	// more than one JSON value.
+	ErrMultipleValues = errors.New("line contains multiple json values")
+)
+
+// The JSONLFunc type is the function called by JSONLProcessor for every line.
+// It gets the decoded line and returns the value that is encoded as output.
+// If it returns false, the line is dropped from the output.
+type JSONLFunc[In, Out any] func(in In, metadata LineMetadata) (Out, bool, error)
+
+// JSONLOpts configures JSONLProcessor.
+type JSONLOpts struct {
+	// DisallowUnknownFields rejects lines with object keys that do not match
+	// any exported field of In, see json.Decoder.DisallowUnknownFields.
+	DisallowUnknownFields bool
+
+	// ReuseBuffers keeps the decoder and encoder buffers of every worker for
+	// all lines of the worker, instead of allocating them for every line.
+	// The buffers are identified by LineMetadata.WorkerId, so Process must
+	// not be called concurrently for the same WorkerId.
+	ReuseBuffers bool
+}
+
+// JSONLProcessor is a LineProcessor for JSON Lines input. It decodes every
+// line into In, calls a JSONLFunc and encodes the returned Out as output line.
+// Empty lines are dropped. The Sequence of LineMetadata.Delimiter is removed
+// from every line before it is decoded and appended to the output line.
+type JSONLProcessor[In, Out any] struct {
+	fn   JSONLFunc[In, Out]
+	opts *JSONLOpts
+
+	codecs map[int]*jsonlCodec
+	sync.Mutex
+}
+
+// NewJSONLProcessor returns a new JSONLProcessor that calls fn for every line.
+func NewJSONLProcessor[In, Out any](fn JSONLFunc[In, Out], opts ...*JSONLOpts) *JSONLProcessor[In, Out] {
+	opt := &JSONLOpts{}
+	if len(opts) > 0 && opts[0] != nil {
+		opt = opts[0]
+	}
+
+	return &JSONLProcessor[In, Out]{
+		fn:     fn,
+		opts:   opt,
+		codecs: make(map[int]*jsonlCodec),
+	}
+}
+
+// Process decodes line, calls the JSONLFunc and encodes its result.
+func (j *JSONLProcessor[In, Out]) Process(line []byte, metadata LineMetadata) ([]byte, error) {
+	delimiter := metadata.Delimiter.orDefault().Sequence
+
+	content := bytes.TrimSuffix(line, delimiter)
+	if len(bytes.TrimSpace(content)) == 0 {
+		return nil, nil
+	}
+
+	codec := j.codec(metadata.WorkerId)
+
+	var in In
+	if err := codec.decode(content, &in); err != nil {
+		return nil, err
+	}
+
+	out, ok, err := j.fn(in, metadata)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	// The last line of a chunk has no delimiter.
+	var sequence []byte
+	if len(content) < len(line) {
+		sequence = delimiter
+	}
+
+	return codec.encode(out, sequence)
+}
+
+// codec returns the jsonlCodec of the worker if ReuseBuffers is set
+// and a new jsonlCodec otherwise.
+func (j *JSONLProcessor[In, Out]) codec(workerId int) *jsonlCodec {
+	if !j.opts.ReuseBuffers {
+		return newJSONLCodec(j.opts.DisallowUnknownFields)
+	}
+
+	j.Lock()
+	defer j.Unlock()
+
+	codec, ok := j.codecs[workerId]
+	if !ok {
+		codec = newJSONLCodec(j.opts.DisallowUnknownFields)
+		j.codecs[workerId] = codec
+	}
+
+	return codec
+}
+
+// jsonlCodec decodes and encodes single lines. The json.Decoder reads from
+// in, which is reset for every line, so both can be reused.
+type jsonlCodec struct {
+	disallowUnknownFields bool
+
+	in      *bytes.Reader
+	decoder *json.Decoder
+	out     bytes.Buffer
+	encoder *json.Encoder
+}
+
+func newJSONLCodec(disallowUnknownFields bool) *jsonlCodec {
+	codec := &jsonlCodec{
+		disallowUnknownFields: disallowUnknownFields,
+		in:                    bytes.NewReader(nil),
+	}
+
+	codec.resetDecoder()
+	codec.encoder = json.NewEncoder(&codec.out)
+	codec.encoder.SetEscapeHTML(false)
+
+	return codec
+}
+
+// resetDecoder replaces the decoder, which can not be used anymore after
+// it returned an error.
+func (c *jsonlCodec) resetDecoder() {
+	c.decoder = json.NewDecoder(c.in)
+	if c.disallowUnknownFields {
+		c.decoder.DisallowUnknownFields()
+	}
+}
+
+// decode decodes the single JSON value of line into v.
+func (c *jsonlCodec) decode(line []byte, v interface{}) error {
+	c.in.Reset(line)
+
+	err := c.decoder.Decode(v)
+	if err == nil && !c.onlyWhitespaceLeft(line) {
+		err = ErrMultipleValues
+	}
+
+	if err != nil {
+		c.resetDecoder()
+
+		if errors.Is(err, ErrMultipleValues) {
+			return err
+		}
+
+		return fmt.Errorf("%w: %s", ErrInvalidJSON, err)
+	}
+
+	return nil
+}
+
+// onlyWhitespaceLeft reports whether the rest of line after the decoded
+// value is whitespace. Decoder.More can not be used, since it would read
+// beyond the line.
+func (c *jsonlCodec) onlyWhitespaceLeft(line []byte) bool {
+	unread := line[len(line)-c.in.Len():]
+	if len(bytes.TrimSpace(unread)) != 0 {
+		return false
+	}
+
+	var buff [64]byte
+	buffered := c.decoder.Buffered()
+
+	for {
+		n, err := buffered.Read(buff[:])
+		if len(bytes.TrimSpace(buff[:n])) != 0 {
+			return false
+		}
+
+		if err != nil {
+			return true
+		}
+	}
+}
+
+// encode returns v as JSON followed by sequence.
+func (c *jsonlCodec) encode(v interface{}, sequence []byte) ([]byte, error) {
+	c.out.Reset()
+
+	if err := c.encoder.Encode(v); err != nil {
+		return nil, err
+	}
+
+	out := bytes.TrimSuffix(c.out.Bytes(), []byte{'\n'})
+
+	result := make([]byte, len(out)+len(sequence))
+	copy(result, out)
+	copy(result[len(out):], sequence)
+
+	return result, nil
+}
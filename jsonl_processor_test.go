@@ -0,0 +1,191 @@
+package conveyor_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fgehrlicher/conveyor"
+	"github.com/stretchr/testify/assert"
+)
+
+type jsonlAnimal struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type jsonlGreeting struct {
+	Id       int    `json:"id"`
+	Greeting string `json:"greeting"`
+}
+
+func greetAnimal(in jsonlAnimal, _ conveyor.LineMetadata) (jsonlGreeting, bool, error) {
+	if in.Id%3 == 0 {
+		return jsonlGreeting{}, false, nil
+	}
+
+	return jsonlGreeting{Id: in.Id, Greeting: "hello <" + in.Name + ">"}, true, nil
+}
+
+func jsonlAnimalLine(i int) string {
+	return fmt.Sprintf("{\"id\":%d,\"name\":\"animal %d\"}", i, i)
+}
+
+func TestJSONLProcessor(t *testing.T) {
+	var (
+		assertion = assert.New(t)
+		lines     = 100
+	)
+
+	testFile, _ := writeLinesTestFile(t, lines, "\n", jsonlAnimalLine)
+
+	var expectedOutput strings.Builder
+	for i := 1; i <= lines; i++ {
+		if i%3 != 0 {
+			fmt.Fprintf(&expectedOutput, "{\"id\":%d,\"greeting\":\"hello <animal %d>\"}\n", i, i)
+		}
+	}
+
+	for _, opts := range []*conveyor.JSONLOpts{nil, {ReuseBuffers: true}, {DisallowUnknownFields: true, ReuseBuffers: true}} {
+		out := &bytes.Buffer{}
+		chunks, err := conveyor.GetChunksFromFile(testFile, 256, conveyor.NewConcurrentWriter(out, true))
+		assertion.NoError(err)
+
+		result := conveyor.NewQueue(chunks, 4, conveyor.NewJSONLProcessor(greetAnimal, opts), &conveyor.QueueOpts{
+			Logger:    NullLogger(),
+			ErrLogger: NullLogger(),
+		}).Work()
+
+		assertion.Empty(result.FailedChunks)
+		assertion.Equal(int64(lines), result.Lines)
+		assertion.Equal(expectedOutput.String(), out.String())
+	}
+}
+
+func TestJSONLProcessorDelimiter(t *testing.T) {
+	var (
+		assertion = assert.New(t)
+		lines     = 100
+	)
+
+	for _, delimiter := range []conveyor.Delimiter{conveyor.NUL, conveyor.SequenceDelimiter("<>")} {
+		testFile, _ := writeLinesTestFile(t, lines, string(delimiter.Sequence), jsonlAnimalLine)
+
+		var expectedOutput strings.Builder
+		for i := 1; i <= lines; i++ {
+			if i%3 != 0 {
+				fmt.Fprintf(&expectedOutput, "{\"id\":%d,\"greeting\":\"hello <animal %d>\"}%s", i, i, delimiter.Sequence)
+			}
+		}
+
+		out := &bytes.Buffer{}
+		chunks, err := conveyor.GetChunksFromFile(testFile, 256, conveyor.NewConcurrentWriter(out, true, delimiter))
+		assertion.NoError(err)
+
+		processor := conveyor.NewJSONLProcessor(greetAnimal)
+		result := conveyor.NewQueue(chunks, 4, processor, &conveyor.QueueOpts{
+			Logger:    NullLogger(),
+			ErrLogger: NullLogger(),
+			Delimiter: delimiter,
+		}).Work()
+
+		assertion.Empty(result.FailedChunks)
+		assertion.Equal(int64(lines), result.Lines)
+		assertion.Equal(expectedOutput.String(), out.String())
+	}
+}
+
+func TestJSONLProcessorErrors(t *testing.T) {
+	assertion := assert.New(t)
+
+	tt := []struct {
+		Line          string
+		Opts          *conveyor.JSONLOpts
+		ExpectedErr   error
+		ExpectedValue string
+	}{
+		{
+			Line:          "{\"id\":1,\"name\":\"a\",\"legs\":4}\n",
+			Opts:          &conveyor.JSONLOpts{},
+			ExpectedValue: "{\"id\":1,\"greeting\":\"hello <a>\"}\n",
+		},
+		{
+			Line:        "{\"id\":1,\"name\":\"a\",\"legs\":4}\n",
+			Opts:        &conveyor.JSONLOpts{DisallowUnknownFields: true},
+			ExpectedErr: conveyor.ErrInvalidJSON,
+		},
+		{
+			Line:        "{\"id\":1,\"name\":\n",
+			Opts:        &conveyor.JSONLOpts{ReuseBuffers: true},
+			ExpectedErr: conveyor.ErrInvalidJSON,
+		},
+		{
+			Line:        "{\"id\":1} {\"id\":2}\n",
+			Opts:        &conveyor.JSONLOpts{ReuseBuffers: true},
+			ExpectedErr: conveyor.ErrMultipleValues,
+		},
+		{
+			Line:        "{\"id\":\"1\"}",
+			Opts:        &conveyor.JSONLOpts{ReuseBuffers: true},
+			ExpectedErr: conveyor.ErrInvalidJSON,
+		},
+		{
+			Line:          "{\"id\":2,\"name\":\"b\"}",
+			Opts:          &conveyor.JSONLOpts{ReuseBuffers: true},
+			ExpectedValue: "{\"id\":2,\"greeting\":\"hello <b>\"}",
+		},
+		{
+			Line: "  \n",
+			Opts: &conveyor.JSONLOpts{},
+		},
+	}
+
+	for _, test := range tt {
+		processor := conveyor.NewJSONLProcessor(greetAnimal, test.Opts)
+
+		// The same worker processes a valid line afterwards to ensure
+		// that the reused buffers are not affected by the error.
+		for _, line := range []string{test.Line, "{\"id\":4,\"name\":\"d\"}\n"} {
+			out, err := processor.Process([]byte(line), conveyor.LineMetadata{WorkerId: 1})
+			if line != test.Line {
+				assertion.NoError(err, test.Line)
+				assertion.Equal("{\"id\":4,\"greeting\":\"hello <d>\"}\n", string(out), test.Line)
+				continue
+			}
+
+			if test.ExpectedErr != nil {
+				assertion.ErrorIs(err, test.ExpectedErr, test.Line)
+				continue
+			}
+
+			assertion.NoError(err, test.Line)
+			assertion.Equal(test.ExpectedValue, string(out), test.Line)
+		}
+	}
+}
+
+func TestJSONLProcessorLineErrorPolicy(t *testing.T) {
+	assertion := assert.New(t)
+	testFile := filepath.Join(t.TempDir(), "animals.jsonl")
+	assertion.NoError(ioutil.WriteFile(testFile, []byte("{\"id\":1,\"name\":\"a\"}\nnot json\n{\"id\":2,\"name\":\"b\"}\n"), 0644))
+
+	out, deadLetters := &bytes.Buffer{}, &bytes.Buffer{}
+	chunks, err := conveyor.GetChunksFromFile(testFile, 1024, conveyor.NewConcurrentWriter(out, true))
+	assertion.NoError(err)
+
+	result := conveyor.NewQueue(chunks, 1, conveyor.NewJSONLProcessor(greetAnimal), &conveyor.QueueOpts{
+		Logger:          NullLogger(),
+		ErrLogger:       NullLogger(),
+		LineErrorPolicy: conveyor.SkipLine,
+		DeadLetter:      conveyor.NewConcurrentWriter(deadLetters, true),
+	}).Work()
+
+	assertion.Empty(result.FailedChunks)
+	assertion.Len(result.Results[0].LineErrors, 1)
+	assertion.ErrorIs(result.Results[0].LineErrors[0], conveyor.ErrInvalidJSON)
+	assertion.Equal("{\"id\":1,\"greeting\":\"hello <a>\"}\n{\"id\":2,\"greeting\":\"hello <b>\"}\n", out.String())
+	assertion.Contains(deadLetters.String(), "not json")
+}
@@ -0,0 +1,101 @@
+package conveyor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// lineScanBlockSize is the size of the blocks GetLineChunksFromFile scans in parallel.
+const lineScanBlockSize = 4 * 1024 * 1024
+
+// ErrUnexpectedLineCount is returned for chunks with more or less lines than Chunk.ExpectedLines.
+var ErrUnexpectedLineCount = errors.New("unexpected line count")
+
+// GetLineChunksFromFile generates a slice of Chunk for a given file path and
+// ChunkWriter, every chunk contains linesPerChunk lines except for the last
+// one. The lines are counted by a parallel scan of the file. The chunks are
+// aligned, so their sizes differ, see Chunk.Aligned. Chunk.StartLine and
+// Chunk.ExpectedLines are set for every chunk.
+func GetLineChunksFromFile(filePath string, linesPerChunk int, out ChunkWriter, delimiter ...Delimiter) ([]Chunk, error) {
+	if linesPerChunk <= 0 {
+		return nil, fmt.Errorf("%w: %d lines per chunk", ErrInvalidChunkSize, linesPerChunk)
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		d       = optionalDelimiter(delimiter)
+		in      = &FileReader{FilePath: filePath}
+		blocks  = getChunks(in, info.Size(), lineScanBlockSize, 1, nil)
+		workers = runtime.NumCPU()
+		perPart = int64(linesPerChunk)
+	)
+
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+
+	if d.Quote != 0 {
+		if err = ScanQuotes(blocks, d.Quote); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = NumberLines(blocks, workers, d); err != nil {
+		return nil, err
+	}
+
+	// Only the blocks that contain the first line of a chunk are scanned
+	// again, and the last block for the number of lines of the file.
+	var (
+		starts = make([][]lineBoundary, len(blocks))
+		lines  int64
+	)
+
+	err = countLines(blocks, workers, d, func(counter *lineCounter, i int) error {
+		var (
+			line = blocks[i].StartLine
+			next = (line-1+perPart-1)/perPart*perPart + 1
+			last = i == len(blocks)-1
+		)
+
+		if !last && next >= blocks[i+1].StartLine {
+			return nil
+		}
+
+		count, err := counter.count(&blocks[i], func(offset int64) {
+			if (line-1)%perPart == 0 {
+				starts[i] = append(starts[i], lineBoundary{offset: offset, line: line})
+			}
+
+			line++
+		})
+
+		if last {
+			lines = blocks[i].StartLine + count - 1
+		}
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var boundaries []lineBoundary
+	for _, blockStarts := range starts {
+		boundaries = append(boundaries, blockStarts...)
+	}
+
+	if len(boundaries) == 0 {
+		return nil, nil
+	}
+
+	boundaries = append(boundaries, lineBoundary{offset: info.Size(), line: lines + 1})
+
+	return alignedChunks(in, boundaries, 0, out), nil
+}
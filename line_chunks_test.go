@@ -0,0 +1,140 @@
+package conveyor_test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fgehrlicher/conveyor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetLineChunksFromFile(t *testing.T) {
+	assertion := assert.New(t)
+	path, lines := writeLinesTestFile(t, 105, "\n", indexTestLine)
+
+	out := &bytes.Buffer{}
+	chunks, err := conveyor.GetLineChunksFromFile(path, 10, conveyor.NewConcurrentWriter(out, true))
+	assertion.NoError(err)
+	assertion.Len(chunks, 11)
+
+	var offset int64
+	for i, chunk := range chunks {
+		expectedLines := 10
+		if i == len(chunks)-1 {
+			expectedLines = 5
+		}
+
+		assertion.Equal(i+1, chunk.Id)
+		assertion.Equal(offset, chunk.Offset)
+		assertion.Equal(int64(i*10+1), chunk.StartLine)
+		assertion.Equal(expectedLines, chunk.ExpectedLines)
+		assertion.True(chunk.Aligned)
+
+		offset += int64(chunk.Size)
+	}
+
+	result := conveyor.NewQueue(chunks, 4, NullLineProcessor, &conveyor.QueueOpts{
+		Logger:    NullLogger(),
+		ErrLogger: NullLogger(),
+	}).Work()
+
+	assertion.Empty(result.FailedChunks)
+	assertion.Equal(int64(105), result.Lines)
+	assertion.Equal(strings.Join(lines, "\n")+"\n", out.String())
+
+	for _, chunkResult := range result.Results {
+		assertion.Equal(chunkResult.Chunk.ExpectedLines, chunkResult.Lines)
+	}
+}
+
+func TestGetLineChunksFromLargeFile(t *testing.T) {
+	var (
+		assertion = assert.New(t)
+		path      = filepath.Join(t.TempDir(), "large.txt")
+		offsets   []int64
+		offset    int64
+	)
+
+	file, err := os.Create(path)
+	assertion.NoError(err)
+
+	writer := bufio.NewWriter(file)
+	for i := 1; i <= 700000; i++ {
+		n, err := fmt.Fprintf(writer, "line %d %s\n", i, strings.Repeat("x", i%13))
+		assertion.NoError(err)
+
+		offsets = append(offsets, offset)
+		offset += int64(n)
+	}
+
+	assertion.NoError(writer.Flush())
+	assertion.NoError(file.Close())
+
+	chunks, err := conveyor.GetLineChunksFromFile(path, 65536, nil)
+	assertion.NoError(err)
+	assertion.Len(chunks, 11)
+
+	for i, chunk := range chunks {
+		start := i * 65536
+		end := start + chunk.ExpectedLines
+
+		assertion.Equal(offsets[start], chunk.Offset)
+		assertion.Equal(int64(start+1), chunk.StartLine)
+
+		if end < len(offsets) {
+			assertion.Equal(65536, chunk.ExpectedLines)
+			assertion.Equal(offsets[end], chunk.Offset+int64(chunk.Size))
+		} else {
+			assertion.Equal(700000%65536, chunk.ExpectedLines)
+			assertion.Equal(offset, chunk.Offset+int64(chunk.Size))
+		}
+	}
+}
+
+func TestUnexpectedLineCount(t *testing.T) {
+	assertion := assert.New(t)
+	path, _ := writeLinesTestFile(t, 30, "\n", indexTestLine)
+
+	chunks, err := conveyor.GetLineChunksFromFile(path, 10, nil)
+	assertion.NoError(err)
+
+	// Like a file that was changed after the chunks were planned.
+	chunks[1].ExpectedLines = 9
+
+	result := conveyor.NewQueue(chunks, 2, NullLineProcessor, &conveyor.QueueOpts{
+		Logger:    NullLogger(),
+		ErrLogger: NullLogger(),
+	}).Work()
+
+	assertion.Equal(1, result.FailedChunks)
+
+	for _, chunkResult := range result.Results {
+		if chunkResult.Chunk.Id == 2 {
+			assertion.ErrorIs(chunkResult.Err, conveyor.ErrUnexpectedLineCount)
+		} else {
+			assertion.NoError(chunkResult.Err)
+		}
+	}
+}
+
+func TestGetLineChunksFromEmptyFile(t *testing.T) {
+	assertion := assert.New(t)
+	path := filepath.Join(t.TempDir(), "empty.txt")
+	assertion.NoError(ioutil.WriteFile(path, nil, 0644))
+
+	chunks, err := conveyor.GetLineChunksFromFile(path, 10, nil)
+	assertion.NoError(err)
+	assertion.Empty(chunks)
+
+	_, err = conveyor.GetLineChunksFromFile(filepath.Join(t.TempDir(), "unknown.txt"), 10, nil)
+	assertion.Error(err)
+
+	_, err = conveyor.GetLineChunksFromFile(path, 0, nil)
+	assertion.ErrorIs(err, conveyor.ErrInvalidChunkSize)
+}
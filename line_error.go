@@ -0,0 +1,47 @@
+package conveyor
+
+import "fmt"
+
+// LineErrorPolicy defines how Worker handles errors returned by LineProcessor.Process.
+type LineErrorPolicy int
+
+const (
+	// FailChunk aborts the chunk on the first failed line. Nothing of the
+	// chunk is written to the ChunkWriter. This is the default.
+	FailChunk LineErrorPolicy = iota
+	// SkipLine drops the failed line from the output and continues with the next line.
+	SkipLine
+	// ReplaceLine replaces the failed line with the result of QueueOpts.LineErrorReplacer.
+	ReplaceLine
+)
+
+// The LineErrorReplacer type is the function used by the ReplaceLine policy.
+// It gets the failed line, its metadata and the error returned by the
+// LineProcessor and returns the replacement. Just like for LineProcessor an
+// empty result drops the line. If LineErrorReplacer returns an error the
+// chunk fails.
+type LineErrorReplacer func(line []byte, metadata LineMetadata, err error) ([]byte, error)
+
+// LineError is the error for a single line that could not be processed.
+// Line is the line number relative to the chunk and Offset the absolute
+// byte offset of the line start inside the chunk's ChunkReader. AbsoluteLine
+// is the line number inside the ChunkReader if it is known, see NumberLines.
+type LineError struct {
+	ChunkId      int
+	Line         int
+	AbsoluteLine int64
+	Offset       int64
+	Err          error
+}
+
+func (l *LineError) Error() string {
+	if l.AbsoluteLine > 0 {
+		return fmt.Sprintf("chunk %d line %d (line %d, offset %d): %s", l.ChunkId, l.Line, l.AbsoluteLine, l.Offset, l.Err)
+	}
+
+	return fmt.Sprintf("chunk %d line %d (offset %d): %s", l.ChunkId, l.Line, l.Offset, l.Err)
+}
+
+func (l *LineError) Unwrap() error {
+	return l.Err
+}
@@ -0,0 +1,481 @@
+package conveyor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// DefaultLineIndexInterval is the number of lines between two offsets of a LineIndex.
+const DefaultLineIndexInterval = 1024
+
+// lineIndexMagic identifies line index files and their format version.
+var lineIndexMagic = []byte("CVLIDX1\n")
+
+var (
+	// ErrInvalidLineIndex is returned for line index files that can not be decoded.
+	ErrInvalidLineIndex = errors.New("invalid line index")
+
+	// ErrStaleLineIndex is returned if a LineIndex does not match its file.
+	ErrStaleLineIndex = errors.New("stale line index")
+
+	// ErrLineOutOfRange is returned for line numbers a file does not contain.
+	ErrLineOutOfRange = errors.New("line out of range")
+)
+
+// LineIndex maps line numbers of a file to byte offsets. It holds the offset
+// of every Interval-th line, starting with line 1, so a line is found by
+// reading at most Interval lines. Size, ModTime and Hash identify the
+// content of the file the index was built for.
+type LineIndex struct {
+	Size      int64
+	ModTime   time.Time
+	Hash      uint64
+	Delimiter Delimiter
+
+	Interval int64
+	Lines    int64
+	// Offsets[i] is the offset of line i*Interval+1.
+	Offsets []int64
+}
+
+// BuildLineIndex reads the file at path and returns its LineIndex.
+// Lines are split like the Worker splits them, so the Delimiter must be the
+// Delimiter of the Queue. An interval of 0 means DefaultLineIndexInterval.
+func BuildLineIndex(path string, interval int, delimiter ...Delimiter) (*LineIndex, error) {
+	if interval <= 0 {
+		interval = DefaultLineIndexInterval
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	index := &LineIndex{
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		Delimiter: optionalDelimiter(delimiter),
+		Interval:  int64(interval),
+	}
+
+	hash := fnv.New64a()
+	err = scanLines(io.TeeReader(file, hash), 0, index.Delimiter, func(start int64) bool {
+		if index.Lines%index.Interval == 0 {
+			index.Offsets = append(index.Offsets, start)
+		}
+
+		index.Lines++
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	index.Hash = hash.Sum64()
+	return index, nil
+}
+
+// LineIndexPath returns the path of the sidecar index file of the file at path.
+func LineIndexPath(path string) string {
+	return path + ".lidx"
+}
+
+// OpenLineIndex returns the LineIndex of the file at path. The sidecar index
+// file at LineIndexPath is used if it matches the file, the Delimiter and the
+// interval, see LineIndex.Check. Otherwise the index is built and the sidecar
+// index file is written.
+func OpenLineIndex(path string, interval int, delimiter ...Delimiter) (*LineIndex, error) {
+	if interval <= 0 {
+		interval = DefaultLineIndexInterval
+	}
+
+	d := optionalDelimiter(delimiter)
+
+	index, err := LoadLineIndex(path)
+	if err == nil && index.Interval == int64(interval) && index.Delimiter.equal(d) {
+		return index, nil
+	}
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) && !errors.Is(err, ErrInvalidLineIndex) && !errors.Is(err, ErrStaleLineIndex) {
+		return nil, err
+	}
+
+	if index, err = BuildLineIndex(path, interval, d); err != nil {
+		return nil, err
+	}
+
+	return index, index.Save(path)
+}
+
+// LoadLineIndex reads the sidecar index file of the file at path and checks
+// that it matches the file, see LineIndex.Check.
+func LoadLineIndex(path string) (*LineIndex, error) {
+	file, err := os.Open(LineIndexPath(path))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	index, err := ReadLineIndex(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return index, index.Check(path)
+}
+
+// Save writes the index to the sidecar index file of the file at path.
+func (l *LineIndex) Save(path string) error {
+	file, err := os.Create(LineIndexPath(path))
+	if err != nil {
+		return err
+	}
+
+	if _, err = l.WriteTo(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// Check returns ErrStaleLineIndex if the size or the modification time of the
+// file at path differ from the index. It does not read the file, see Verify.
+func (l *LineIndex) Check(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.Size() != l.Size || !info.ModTime().Equal(l.ModTime) {
+		return fmt.Errorf("%w: %s was modified", ErrStaleLineIndex, path)
+	}
+
+	return nil
+}
+
+// Verify is like Check, but also compares the Hash of the content of the file.
+func (l *LineIndex) Verify(path string) error {
+	if err := l.Check(path); err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := fnv.New64a()
+	if _, err = io.Copy(hash, file); err != nil {
+		return err
+	}
+
+	if hash.Sum64() != l.Hash {
+		return fmt.Errorf("%w: content of %s changed", ErrStaleLineIndex, path)
+	}
+
+	return nil
+}
+
+// Offset returns the offset of line, starting at 1, inside the file at path.
+// Line Lines+1 is the end of the file.
+func (l *LineIndex) Offset(path string, line int64) (int64, error) {
+	if line < 1 || line > l.Lines+1 {
+		return 0, fmt.Errorf("%w: %d", ErrLineOutOfRange, line)
+	}
+
+	if line == l.Lines+1 {
+		return l.Size, nil
+	}
+
+	var (
+		point  = (line - 1) / l.Interval
+		skip   = (line - 1) % l.Interval
+		offset = l.Offsets[point]
+	)
+
+	if skip == 0 {
+		return offset, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	err = scanLines(file, offset, l.Delimiter, func(start int64) bool {
+		offset = start
+		skip--
+
+		return skip >= 0
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return offset, nil
+}
+
+// Chunks splits the file at path into chunks at line boundaries of the
+// index. Every chunk is aligned, see Chunk.Aligned, and contains as many
+// intervals of the index as fit into chunkSize, but at least one.
+// Chunk.StartLine and Chunk.ExpectedLines are set for every chunk.
+func (l *LineIndex) Chunks(path string, chunkSize int, out ChunkWriter) []Chunk {
+	boundaries := make([]lineBoundary, 0, len(l.Offsets)+1)
+	for i, offset := range l.Offsets {
+		boundaries = append(boundaries, lineBoundary{offset: offset, line: int64(i)*l.Interval + 1})
+	}
+
+	boundaries = append(boundaries, lineBoundary{offset: l.Size, line: l.Lines + 1})
+
+	return alignedChunks(&FileReader{FilePath: path}, boundaries, chunkSize, out)
+}
+
+// RangeChunks is like Chunks, but the chunks only contain the lines firstLine
+// to lastLine of the file at path, both inclusive and starting at 1.
+func (l *LineIndex) RangeChunks(path string, firstLine, lastLine int64, chunkSize int, out ChunkWriter) ([]Chunk, error) {
+	if firstLine > lastLine || lastLine > l.Lines {
+		return nil, fmt.Errorf("%w: %d to %d", ErrLineOutOfRange, firstLine, lastLine)
+	}
+
+	start, err := l.Offset(path, firstLine)
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := l.Offset(path, lastLine+1)
+	if err != nil {
+		return nil, err
+	}
+
+	boundaries := []lineBoundary{{offset: start, line: firstLine}}
+
+	first := sort.Search(len(l.Offsets), func(i int) bool { return l.Offsets[i] > start })
+	for i := first; i < len(l.Offsets) && l.Offsets[i] < end; i++ {
+		boundaries = append(boundaries, lineBoundary{offset: l.Offsets[i], line: int64(i)*l.Interval + 1})
+	}
+
+	boundaries = append(boundaries, lineBoundary{offset: end, line: lastLine + 1})
+
+	return alignedChunks(&FileReader{FilePath: path}, boundaries, chunkSize, out), nil
+}
+
+// lineBoundary is the offset of the start of a line and its number.
+type lineBoundary struct {
+	offset int64
+	line   int64
+}
+
+// alignedChunks groups the lines between consecutive boundaries into chunks
+// of at most chunkSize, unless the lines between two boundaries are larger.
+// A chunkSize of 0 creates a chunk for every two consecutive boundaries.
+func alignedChunks(in ChunkReader, boundaries []lineBoundary, chunkSize int, out ChunkWriter) []Chunk {
+	var chunks []Chunk
+
+	for i := 0; i < len(boundaries)-1; {
+		start := boundaries[i]
+
+		next := i + 1
+		for next+1 < len(boundaries) && boundaries[next+1].offset-start.offset <= int64(chunkSize) {
+			next++
+		}
+
+		chunks = append(chunks, Chunk{
+			Id:        len(chunks) + 1,
+			Offset:    start.offset,
+			Size:      int(boundaries[next].offset - start.offset),
+			In:        in,
+			Out:       out,
+			StartLine: start.line,
+			Aligned:   true,
+
+			ExpectedLines: int(boundaries[next].line - start.line),
+		})
+
+		i = next
+	}
+
+	return chunks
+}
+
+// scanLines calls fn with the offset of every line start in r until fn returns
+// false. offset is the offset of the start of r, which must be a line start.
+func scanLines(r io.Reader, offset int64, delimiter Delimiter, fn func(start int64) bool) error {
+	var (
+		sequence = delimiter.Sequence
+		buff     = make([]byte, quoteScanBuffSize)
+		window   []byte
+		quoted   bool
+		// pending is the start of the next line, which is only
+		// passed to fn once it is known that the line is not empty.
+		pending = offset
+	)
+
+	for {
+		n, err := r.Read(buff)
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		window = append(window, buff[:n]...)
+
+		for position := 0; ; {
+			if pending != -1 && pending < offset+int64(len(window)) {
+				if !fn(pending) {
+					return nil
+				}
+
+				pending = -1
+			}
+
+			i := delimiter.index(window[position:], quoted)
+			if i == -1 {
+				// The delimiter may be split between two reads.
+				keep := len(window) - len(sequence) + 1
+				if keep < position {
+					keep = position
+				}
+
+				quoted = delimiter.quoted(window[position:keep], quoted)
+				offset += int64(keep)
+				window = append(window[:0], window[keep:]...)
+
+				break
+			}
+
+			position += i + len(sequence)
+			pending = offset + int64(position)
+			quoted = false
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// WriteTo writes the index in its compact binary format to w. The offsets are
+// stored as variable length differences.
+func (l *LineIndex) WriteTo(w io.Writer) (int64, error) {
+	var (
+		buff = bytes.NewBuffer(append([]byte(nil), lineIndexMagic...))
+		tmp  [binary.MaxVarintLen64]byte
+	)
+
+	putUvarint := func(v uint64) {
+		buff.Write(tmp[:binary.PutUvarint(tmp[:], v)])
+	}
+
+	putUvarint(uint64(l.Size))
+	putUvarint(uint64(l.ModTime.UnixNano()))
+	putUvarint(l.Hash)
+	putUvarint(uint64(len(l.Delimiter.Sequence)))
+	buff.Write(l.Delimiter.Sequence)
+	buff.WriteByte(l.Delimiter.Quote)
+	putUvarint(uint64(l.Interval))
+	putUvarint(uint64(l.Lines))
+	putUvarint(uint64(len(l.Offsets)))
+
+	var previous int64
+	for _, offset := range l.Offsets {
+		putUvarint(uint64(offset - previous))
+		previous = offset
+	}
+
+	return buff.WriteTo(w)
+}
+
+// offsetCount returns the number of offsets of an index of lines lines, there
+// is one for every interval-th line, starting with line 1.
+func offsetCount(lines, interval int64) int64 {
+	count := lines / interval
+	if lines%interval != 0 {
+		count++
+	}
+
+	return count
+}
+
+// ReadLineIndex reads an index written by LineIndex.WriteTo.
+func ReadLineIndex(r io.Reader) (*LineIndex, error) {
+	var (
+		reader = bufio.NewReader(r)
+		magic  = make([]byte, len(lineIndexMagic))
+		err    error
+	)
+
+	if _, err = io.ReadFull(reader, magic); err != nil || !bytes.Equal(magic, lineIndexMagic) {
+		return nil, fmt.Errorf("%w: unknown format", ErrInvalidLineIndex)
+	}
+
+	readUvarint := func() uint64 {
+		if err != nil {
+			return 0
+		}
+
+		var v uint64
+		v, err = binary.ReadUvarint(reader)
+		return v
+	}
+
+	index := &LineIndex{
+		Size:    int64(readUvarint()),
+		ModTime: time.Unix(0, int64(readUvarint())),
+		Hash:    readUvarint(),
+	}
+
+	if sequence := readUvarint(); err == nil && (sequence == 0 || sequence > 255) {
+		err = errors.New("invalid delimiter")
+	} else if err == nil {
+		index.Delimiter.Sequence = make([]byte, sequence)
+		_, err = io.ReadFull(reader, index.Delimiter.Sequence)
+	}
+
+	if err == nil {
+		index.Delimiter.Quote, err = reader.ReadByte()
+	}
+
+	index.Interval = int64(readUvarint())
+	index.Lines = int64(readUvarint())
+
+	if err == nil && (index.Interval <= 0 || index.Lines < 0) {
+		err = errors.New("invalid interval or line count")
+	}
+
+	offsets := readUvarint()
+	if err == nil && offsets != uint64(offsetCount(index.Lines, index.Interval)) {
+		err = fmt.Errorf("%d offsets for %d lines", offsets, index.Lines)
+	}
+
+	var offset int64
+	for i := uint64(0); i < offsets && err == nil; i++ {
+		offset += int64(readUvarint())
+		index.Offsets = append(index.Offsets, offset)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidLineIndex, err)
+	}
+
+	return index, nil
+}
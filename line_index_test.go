@@ -0,0 +1,206 @@
+package conveyor_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fgehrlicher/conveyor"
+	"github.com/stretchr/testify/assert"
+)
+
+// indexTestLine returns lines of different lengths.
+func indexTestLine(i int) string {
+	return fmt.Sprintf("line %d %s", i, strings.Repeat("x", i*7%23))
+}
+
+func TestBuildLineIndex(t *testing.T) {
+	assertion := assert.New(t)
+	path, lines := writeLinesTestFile(t, 20, "\n", indexTestLine)
+
+	index, err := conveyor.BuildLineIndex(path, 3)
+	assertion.NoError(err)
+	assertion.Equal(int64(20), index.Lines)
+	assertion.Equal(int64(3), index.Interval)
+	assertion.Len(index.Offsets, 7)
+
+	var offset int64
+	for i, line := range lines {
+		lineOffset, err := index.Offset(path, int64(i+1))
+		assertion.NoError(err)
+		assertion.Equal(offset, lineOffset, i+1)
+
+		offset += int64(len(line) + 1)
+	}
+
+	end, err := index.Offset(path, 21)
+	assertion.NoError(err)
+	assertion.Equal(index.Size, end)
+
+	_, err = index.Offset(path, 0)
+	assertion.ErrorIs(err, conveyor.ErrLineOutOfRange)
+
+	_, err = index.Offset(path, 22)
+	assertion.ErrorIs(err, conveyor.ErrLineOutOfRange)
+}
+
+func TestLineIndexSidecar(t *testing.T) {
+	assertion := assert.New(t)
+	path, _ := writeLinesTestFile(t, 100, "\n", indexTestLine)
+
+	_, err := conveyor.LoadLineIndex(path)
+	assertion.ErrorIs(err, os.ErrNotExist)
+
+	index, err := conveyor.OpenLineIndex(path, 10)
+	assertion.NoError(err)
+	assertion.FileExists(conveyor.LineIndexPath(path))
+
+	loaded, err := conveyor.LoadLineIndex(path)
+	assertion.NoError(err)
+	assertion.Equal(index.Offsets, loaded.Offsets)
+	assertion.Equal(index.Lines, loaded.Lines)
+	assertion.Equal(index.Hash, loaded.Hash)
+	assertion.True(index.ModTime.Equal(loaded.ModTime))
+	assertion.NoError(loaded.Verify(path))
+
+	// Same size and modification time, but different content.
+	content, err := ioutil.ReadFile(path)
+	assertion.NoError(err)
+	assertion.NoError(ioutil.WriteFile(path, bytes.Replace(content, []byte("line 1 "), []byte("line_1 "), 1), 0644))
+	assertion.NoError(os.Chtimes(path, index.ModTime, index.ModTime))
+	assertion.NoError(loaded.Check(path))
+	assertion.ErrorIs(loaded.Verify(path), conveyor.ErrStaleLineIndex)
+
+	assertion.NoError(ioutil.WriteFile(path, append(content, "line 101\n"...), 0644))
+	assertion.NoError(os.Chtimes(path, time.Now(), index.ModTime.Add(time.Hour)))
+
+	_, err = conveyor.LoadLineIndex(path)
+	assertion.ErrorIs(err, conveyor.ErrStaleLineIndex)
+
+	rebuilt, err := conveyor.OpenLineIndex(path, 10)
+	assertion.NoError(err)
+	assertion.Equal(int64(101), rebuilt.Lines)
+
+	_, err = conveyor.LoadLineIndex(path)
+	assertion.NoError(err)
+
+	_, err = conveyor.ReadLineIndex(strings.NewReader("not an index"))
+	assertion.ErrorIs(err, conveyor.ErrInvalidLineIndex)
+
+	var buff bytes.Buffer
+	_, err = rebuilt.WriteTo(&buff)
+	assertion.NoError(err)
+
+	_, err = conveyor.ReadLineIndex(bytes.NewReader(buff.Bytes()[:buff.Len()-2]))
+	assertion.ErrorIs(err, conveyor.ErrInvalidLineIndex)
+}
+
+func TestReadLineIndexValidatesOffsets(t *testing.T) {
+	assertion := assert.New(t)
+
+	for _, index := range []*conveyor.LineIndex{
+		{Delimiter: conveyor.LF, Interval: 0, Lines: 10, Offsets: []int64{0}},
+		{Delimiter: conveyor.LF, Interval: 4, Lines: 10, Offsets: []int64{0, 20}},
+		{Delimiter: conveyor.LF, Interval: 4, Lines: 10, Offsets: []int64{0, 20, 40, 60}},
+		{Delimiter: conveyor.LF, Interval: 4, Lines: 0, Offsets: []int64{0}},
+	} {
+		var buff bytes.Buffer
+		_, err := index.WriteTo(&buff)
+		assertion.NoError(err)
+
+		_, err = conveyor.ReadLineIndex(&buff)
+		assertion.ErrorIs(err, conveyor.ErrInvalidLineIndex, index)
+	}
+
+	var buff bytes.Buffer
+	_, err := (&conveyor.LineIndex{Delimiter: conveyor.LF, Interval: 4, Lines: 10, Offsets: []int64{0, 20, 40}}).WriteTo(&buff)
+	assertion.NoError(err)
+
+	index, err := conveyor.ReadLineIndex(&buff)
+	assertion.NoError(err)
+	assertion.Equal([]int64{0, 20, 40}, index.Offsets)
+}
+
+func TestLineIndexChunks(t *testing.T) {
+	assertion := assert.New(t)
+
+	for _, delimiter := range []string{"\n", "<>"} {
+		path, lines := writeLinesTestFile(t, 200, delimiter, indexTestLine)
+		d := conveyor.SequenceDelimiter(delimiter)
+		content := strings.Join(lines, delimiter) + delimiter
+
+		index, err := conveyor.BuildLineIndex(path, 8, d)
+		assertion.NoError(err)
+
+		for _, chunkSize := range []int{64, 512, 100000} {
+			var (
+				out      = &bytes.Buffer{}
+				chunks   = index.Chunks(path, chunkSize, conveyor.NewConcurrentWriter(out, true, d))
+				recorder = newLineNumberRecorder()
+			)
+
+			for _, chunk := range chunks {
+				assertion.True(chunk.Aligned)
+			}
+
+			result := conveyor.NewQueue(chunks, 4, recorder, &conveyor.QueueOpts{
+				Logger:    NullLogger(),
+				ErrLogger: NullLogger(),
+				Delimiter: d,
+			}).Work()
+
+			assertion.Empty(result.FailedChunks)
+			assertion.Equal(int64(200), result.Lines)
+			assertion.Equal(content, out.String())
+
+			// No overflow is read for aligned chunks.
+			for _, chunkResult := range result.Results {
+				assertion.LessOrEqual(chunkResult.RealSize, chunkResult.Chunk.Size)
+			}
+
+			if delimiter == "\n" {
+				recorder.assertLines(assertion, content, chunkSize)
+			}
+		}
+	}
+}
+
+func TestLineIndexRangeChunks(t *testing.T) {
+	assertion := assert.New(t)
+	path, lines := writeLinesTestFile(t, 100, "\n", indexTestLine)
+
+	index, err := conveyor.BuildLineIndex(path, 16)
+	assertion.NoError(err)
+
+	for _, lineRange := range [][2]int64{{1, 100}, {7, 23}, {16, 17}, {50, 50}, {90, 100}} {
+		out := &bytes.Buffer{}
+
+		chunks, err := index.RangeChunks(path, lineRange[0], lineRange[1], 128, conveyor.NewConcurrentWriter(out, true))
+		assertion.NoError(err)
+
+		recorder := newLineNumberRecorder()
+		result := conveyor.NewQueue(chunks, 4, recorder, &conveyor.QueueOpts{
+			Logger:    NullLogger(),
+			ErrLogger: NullLogger(),
+		}).Work()
+
+		expectedLines := lines[lineRange[0]-1 : lineRange[1]]
+		assertion.Empty(result.FailedChunks)
+		assertion.Equal(int64(len(expectedLines)), result.Lines)
+		assertion.Equal(strings.Join(expectedLines, "\n"), strings.TrimSuffix(out.String(), "\n"), lineRange)
+
+		for i, line := range expectedLines {
+			assertion.Equal(line, recorder.lines[lineRange[0]+int64(i)], lineRange)
+		}
+	}
+
+	_, err = index.RangeChunks(path, 10, 101, 128, nil)
+	assertion.ErrorIs(err, conveyor.ErrLineOutOfRange)
+
+	_, err = index.RangeChunks(path, 0, 10, 128, nil)
+	assertion.ErrorIs(err, conveyor.ErrLineOutOfRange)
+}
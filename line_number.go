@@ -0,0 +1,170 @@
+package conveyor
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// NumberLines sets Chunk.StartLine of all chunks, so LineMetadata.AbsoluteLine
+// is set for every line. The lines of the chunks are counted in parallel by
+// the given number of workers before any chunk is processed, which requires
+// an additional read of the input. The chunks of every ChunkReader must be
+// ordered by their offsets and cover it without gaps, like the chunks returned
+// by GetChunksFromFile or PlanChunks. If the Delimiter has a Quote,
+// Chunk.InQuotes must be set first, see ScanQuotes.
+func NumberLines(chunks []Chunk, workers int, delimiter ...Delimiter) error {
+	counts := make([]int64, len(chunks))
+
+	err := countLines(chunks, workers, optionalDelimiter(delimiter), func(counter *lineCounter, i int) (err error) {
+		counts[i], err = counter.count(&chunks[i], nil)
+		return
+	})
+	if err != nil {
+		return err
+	}
+
+	var (
+		handleID string
+		offset   int64
+		line     int64
+	)
+
+	for i := range chunks {
+		chunk := &chunks[i]
+
+		if i == 0 || chunk.In.GetHandleID() != handleID || chunk.Offset < offset {
+			handleID = chunk.In.GetHandleID()
+			line = 1
+		}
+
+		offset = chunk.Offset
+		chunk.StartLine = line
+		line += counts[i]
+	}
+
+	return nil
+}
+
+// countLines calls fn for all chunks in parallel and returns the first error.
+// Every one of the workers uses its own lineCounter.
+func countLines(chunks []Chunk, workers int, delimiter Delimiter, fn func(counter *lineCounter, i int) error) error {
+	var (
+		tasks = make(chan int)
+		errs  = make([]error, workers)
+		wg    sync.WaitGroup
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+
+		go func(worker int) {
+			defer wg.Done()
+
+			counter := &lineCounter{delimiter: delimiter}
+			defer counter.close()
+
+			for i := range tasks {
+				if errs[worker] == nil {
+					errs[worker] = fn(counter, i)
+				}
+			}
+		}(i)
+	}
+
+	for i := range chunks {
+		tasks <- i
+	}
+
+	close(tasks)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lineCounter counts the lines of chunks like the Worker splits them. The
+// handle of the last ChunkReader is kept open for the next chunk.
+type lineCounter struct {
+	delimiter  Delimiter
+	handle     io.ReadSeekCloser
+	handleName string
+	lookbehind []byte
+	buff       []byte
+}
+
+// count returns the number of lines that start inside of chunk. If
+// onStart is not nil, it is called with the offset of every line.
+func (l *lineCounter) count(chunk *Chunk, onStart func(offset int64)) (int64, error) {
+	if l.handle == nil || chunk.In.GetHandleID() != l.handleName {
+		l.close()
+
+		handle, err := chunk.In.OpenHandle()
+		if err != nil {
+			return 0, fmt.Errorf("error while counting lines of chunk %d: %w", chunk.Id, err)
+		}
+
+		l.handle = handle
+		l.handleName = chunk.In.GetHandleID()
+	}
+
+	lookbehind, err := readLookbehind(l.handle, l.delimiter, chunk.Offset, l.lookbehind)
+	if err != nil {
+		return 0, fmt.Errorf("error while counting lines of chunk %d: %w", chunk.Id, err)
+	}
+
+	l.lookbehind = lookbehind
+	if cap(l.buff) < chunk.Size {
+		l.buff = make([]byte, chunk.Size)
+	}
+
+	n, err := io.ReadFull(l.handle, l.buff[:chunk.Size])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, fmt.Errorf("error while counting lines of chunk %d: %w", chunk.Id, err)
+	}
+
+	if n == 0 {
+		return 0, nil
+	}
+
+	var (
+		buff  = l.buff[:n]
+		start int
+		lines int64
+	)
+
+	if chunk.Offset != 0 {
+		if start, _ = firstRecordStart(l.delimiter, lookbehind, buff, chunk.InQuotes); start == -1 {
+			return 0, nil
+		}
+	}
+
+	for start < len(buff) {
+		lines++
+
+		if onStart != nil {
+			onStart(chunk.Offset + int64(start))
+		}
+
+		i := l.delimiter.index(buff[start:], false)
+		if i == -1 {
+			break
+		}
+
+		start += i + len(l.delimiter.Sequence)
+	}
+
+	return lines, nil
+}
+
+func (l *lineCounter) close() {
+	if l.handle != nil {
+		l.handle.Close()
+		l.handle = nil
+	}
+}
@@ -0,0 +1,218 @@
+package conveyor_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fgehrlicher/conveyor"
+	"github.com/stretchr/testify/assert"
+)
+
+// lineNumberRecorder records the content and offset of every line by its
+// absolute line number.
+type lineNumberRecorder struct {
+	sync.Mutex
+	lines   map[int64]string
+	offsets map[int64]int64
+}
+
+func newLineNumberRecorder() *lineNumberRecorder {
+	return &lineNumberRecorder{
+		lines:   make(map[int64]string),
+		offsets: make(map[int64]int64),
+	}
+}
+
+func (l *lineNumberRecorder) Process(line []byte, metadata conveyor.LineMetadata) ([]byte, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.lines[metadata.AbsoluteLine] = strings.TrimSuffix(string(line), "\n")
+	l.offsets[metadata.AbsoluteLine] = metadata.Offset
+
+	return line, nil
+}
+
+// assertLines checks that every line of content was recorded with its line number and offset.
+func (l *lineNumberRecorder) assertLines(assertion *assert.Assertions, content string, msgAndArgs ...interface{}) {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	assertion.Len(l.lines, len(lines), msgAndArgs...)
+
+	var offset int64
+	for i, line := range lines {
+		number := int64(i + 1)
+
+		assertion.Equal(strings.TrimSuffix(line, "\n"), l.lines[number], msgAndArgs...)
+		assertion.Equal(offset, l.offsets[number], msgAndArgs...)
+
+		offset += int64(len(line))
+	}
+}
+
+func TestNumberLines(t *testing.T) {
+	var (
+		assertion = assert.New(t)
+		testFile  = filepath.Join(t.TempDir(), "lines.txt")
+		content   strings.Builder
+	)
+
+	for i := 1; i <= 50; i++ {
+		content.WriteString(strings.Repeat(string(rune('a'+i%26)), i*i%41))
+		content.WriteString("\n")
+	}
+
+	assertion.NoError(ioutil.WriteFile(testFile, []byte(content.String()), 0644))
+
+	for _, chunkSize := range []int{1, 7, 64, 4096} {
+		chunks, err := conveyor.GetChunksFromFile(testFile, chunkSize, nil)
+		assertion.NoError(err)
+		assertion.NoError(conveyor.NumberLines(chunks, 4))
+		assertion.Equal(int64(1), chunks[0].StartLine)
+
+		recorder := newLineNumberRecorder()
+		result := conveyor.NewQueue(chunks, 4, recorder, &conveyor.QueueOpts{
+			Logger:    NullLogger(),
+			ErrLogger: NullLogger(),
+		}).Work()
+
+		assertion.Empty(result.FailedChunks, chunkSize)
+		recorder.assertLines(assertion, content.String(), chunkSize)
+	}
+}
+
+func TestNumberLinesRestartsForEveryReader(t *testing.T) {
+	assertion := assert.New(t)
+
+	plan, err := conveyor.PlanChunks([]string{"testdata/5_lines.txt", "testdata/data.txt"}, 64, nil)
+	assertion.NoError(err)
+	assertion.NoError(conveyor.NumberLines(plan.Chunks, 2))
+
+	second := plan.Files[1].FirstChunk - 1
+	assertion.Equal(int64(1), plan.Chunks[0].StartLine)
+	assertion.Equal(int64(1), plan.Chunks[second].StartLine)
+	assertion.Greater(plan.Chunks[second-1].StartLine, int64(1))
+}
+
+func TestNumberLinesFailsForInvalidReader(t *testing.T) {
+	assertion := assert.New(t)
+
+	chunks := generateTestChunks(3, 64, "testdata/unknown.txt")
+	assertion.Error(conveyor.NumberLines(chunks, 2))
+}
+
+func TestQueueNumberLines(t *testing.T) {
+	assertion := assert.New(t)
+	paths := writeCompressedTestFiles(t)
+	paths["plain"] = "testdata/data.txt"
+
+	content, err := ioutil.ReadFile("testdata/data.txt")
+	assertion.NoError(err)
+
+	for format, path := range paths {
+		recorder := newLineNumberRecorder()
+
+		queue := conveyor.NewDynamicQueue(4, 256, recorder, &conveyor.QueueOpts{
+			Logger:      NullLogger(),
+			ErrLogger:   NullLogger(),
+			NumberLines: true,
+		})
+
+		queue.Start(context.Background())
+
+		go func(path string) {
+			assertion.NoError(queue.SubmitFile(path, conveyor.NewConcurrentWriter(&bytes.Buffer{}, true)))
+			queue.Close()
+		}(path)
+
+		result := queue.Wait()
+		assertion.Empty(result.FailedChunks, format)
+		recorder.assertLines(assertion, string(content), format)
+	}
+}
+
+func TestQueueNumberLinesOfGivenChunks(t *testing.T) {
+	assertion := assert.New(t)
+	opts := &conveyor.QueueOpts{
+		Logger:      NullLogger(),
+		ErrLogger:   NullLogger(),
+		NumberLines: true,
+	}
+
+	content, err := ioutil.ReadFile("testdata/data.txt")
+	assertion.NoError(err)
+
+	chunks, err := conveyor.GetChunksFromFile("testdata/data.txt", 256, nil)
+	assertion.NoError(err)
+
+	recorder := newLineNumberRecorder()
+	result := conveyor.NewQueue(chunks, 4, recorder, opts).Work()
+
+	assertion.NoError(result.Err)
+	recorder.assertLines(assertion, string(content), "NewQueue")
+
+	recorder = newLineNumberRecorder()
+	queue := conveyor.NewDynamicQueue(4, 256, recorder, opts)
+	queue.Start(context.Background())
+
+	go func() {
+		assertion.NoError(queue.Submit(chunks...))
+		queue.Close()
+	}()
+
+	result = queue.Wait()
+
+	assertion.NoError(result.Err)
+	recorder.assertLines(assertion, string(content), "Submit")
+
+	invalidChunks := generateTestChunks(3, 64, "testdata/unknown.txt")
+	result = conveyor.NewQueue(invalidChunks, 2, recorder, opts).Work()
+
+	assertion.Error(result.Err)
+	assertion.Equal(len(invalidChunks), result.UnprocessedChunks)
+}
+
+func TestLineErrorContainsAbsoluteLine(t *testing.T) {
+	assertion := assert.New(t)
+	lineErr := errors.New("invalid line")
+
+	chunks, err := conveyor.GetChunksFromFile("testdata/5_lines.txt", 16, nil)
+	assertion.NoError(err)
+	assertion.NoError(conveyor.NumberLines(chunks, 2))
+
+	result := conveyor.NewQueue(
+		chunks,
+		2,
+		conveyor.LineProcessorFunc(func(line []byte, metadata conveyor.LineMetadata) ([]byte, error) {
+			if metadata.AbsoluteLine == 4 {
+				return nil, lineErr
+			}
+
+			return line, nil
+		}),
+		&conveyor.QueueOpts{
+			Logger:          NullLogger(),
+			ErrLogger:       NullLogger(),
+			LineErrorPolicy: conveyor.SkipLine,
+		},
+	).Work()
+
+	var lineErrors []*conveyor.LineError
+	for _, chunkResult := range result.Results {
+		lineErrors = append(lineErrors, chunkResult.LineErrors...)
+	}
+
+	assertion.Len(lineErrors, 1)
+	assertion.Equal(int64(4), lineErrors[0].AbsoluteLine)
+	assertion.ErrorIs(lineErrors[0], lineErr)
+	assertion.Contains(lineErrors[0].Error(), "(line 4, offset")
+}
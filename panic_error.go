@@ -0,0 +1,46 @@
+package conveyor
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is the error of a chunk whose processing panicked, e.g. in the
+// LineProcessor. Line is the number of the line relative to the chunk that
+// was processed when the panic occurred, or 0 if it occurred outside of
+// LineProcessor.Process. Value is the value passed to panic and Stack the
+// stack trace of the panicking goroutine.
+type PanicError struct {
+	ChunkId int
+	Line    int
+	Value   interface{}
+	Stack   []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("panic in chunk %d line %d: %v\n%s", p.ChunkId, p.Line, p.Value, p.Stack)
+}
+
+// Unwrap returns Value if it is an error.
+func (p *PanicError) Unwrap() error {
+	err, _ := p.Value.(error)
+	return err
+}
+
+// recoverPanic converts a panic during Worker.Process into a PanicError,
+// so the Worker stays alive for the next chunks.
+func (w *Worker) recoverPanic(err *error) {
+	value := recover()
+	if value == nil {
+		return
+	}
+
+	*err = &PanicError{
+		ChunkId: w.chunk.Id,
+		Line:    w.currentLine,
+		Value:   value,
+		Stack:   debug.Stack(),
+	}
+
+	w.currentLine = 0
+}
@@ -0,0 +1,101 @@
+package conveyor_test
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/fgehrlicher/conveyor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerRecoversPanic(t *testing.T) {
+	assertion := assert.New(t)
+	panicErr := errors.New("panic error")
+
+	processor := conveyor.LineProcessorFunc(func(line []byte, metadata conveyor.LineMetadata) ([]byte, error) {
+		if metadata.Chunk.Id == 2 && metadata.Line == 3 {
+			panic(panicErr)
+		}
+
+		return line, nil
+	})
+
+	chunks, err := conveyor.GetChunksFromFile("testdata/data.txt", 512, nil)
+	assertion.NoError(err)
+
+	result := conveyor.NewQueue(chunks, 1, processor, &conveyor.QueueOpts{
+		Logger:    NullLogger(),
+		ErrLogger: NullLogger(),
+	}).Work()
+
+	assertion.Equal(1, result.FailedChunks)
+	assertion.Len(result.Results, len(chunks))
+
+	for _, chunkResult := range result.Results {
+		if chunkResult.Chunk.Id != 2 {
+			assertion.NoError(chunkResult.Err)
+			continue
+		}
+
+		var recovered *conveyor.PanicError
+		assertion.True(errors.As(chunkResult.Err, &recovered))
+		assertion.ErrorIs(chunkResult.Err, panicErr)
+		assertion.Equal(2, recovered.ChunkId)
+		assertion.Equal(3, recovered.Line)
+		assertion.Equal(panicErr, recovered.Value)
+		assertion.True(bytes.Contains(recovered.Stack, []byte("TestWorkerRecoversPanic")))
+	}
+}
+
+type panicWriter struct{}
+
+func (panicWriter) Write(*conveyor.Chunk, []byte) error {
+	panic("panic value")
+}
+
+func TestWorkerRecoversPanicOutsideOfLines(t *testing.T) {
+	assertion := assert.New(t)
+
+	chunks, err := conveyor.GetChunksFromFile("testdata/data.txt", 512, panicWriter{})
+	assertion.NoError(err)
+
+	result := conveyor.NewQueue(chunks, 2, NullLineProcessor, &conveyor.QueueOpts{
+		Logger:    NullLogger(),
+		ErrLogger: NullLogger(),
+	}).Work()
+
+	assertion.Equal(len(chunks), result.FailedChunks)
+	for _, chunkResult := range result.Results {
+		var recovered *conveyor.PanicError
+		assertion.True(errors.As(chunkResult.Err, &recovered))
+		assertion.Equal(0, recovered.Line)
+		assertion.Equal("panic value", recovered.Value)
+	}
+}
+
+func TestWorkerRepanic(t *testing.T) {
+	assertion := assert.New(t)
+
+	tasks := GetSingleChunkChan("testdata/data.txt", 512, nil)
+	results := make(chan conveyor.ChunkResult, 1)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	worker := conveyor.NewWorker(
+		1,
+		tasks,
+		results,
+		conveyor.LineProcessorFunc(func([]byte, conveyor.LineMetadata) ([]byte, error) {
+			panic("panic value")
+		}),
+		512,
+		1024,
+		wg,
+		&conveyor.QueueOpts{Repanic: true},
+	)
+
+	assertion.PanicsWithValue("panic value", worker.Work)
+}
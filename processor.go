@@ -1,5 +1,7 @@
 package conveyor
 
+import "context"
+
 // LineProcessor is the interface that wraps the Process method.
 //
 // Process gets the line that needs to be processed with the line metadata
@@ -14,10 +16,22 @@ type LineProcessor interface {
 // LineMetadata is the metadata passed to LineProcessor.Process.
 // Line is the line number relative to the chunk.
 // Chunk is a pointer to the chunk which contains that line.
+// Context is the context of the current Queue run. Long-running processors
+// should stop and return Context.Err() once it is done.
 type LineMetadata struct {
 	WorkerId int
 	Line     int
 	Chunk    *Chunk
+	Context  context.Context
+
+	// AbsoluteLine is the number of the line inside the ChunkReader of the
+	// chunk, starting at 1. It is 0 if Chunk.StartLine is not set.
+	AbsoluteLine int64
+	// Offset is the byte offset of the line inside the ChunkReader of the chunk.
+	Offset int64
+	// Delimiter is the Delimiter of the Queue. Its Sequence terminates
+	// every line except the last line of the chunk.
+	Delimiter Delimiter
 }
 
 // The LineProcessorFunc type is an adapter that allows the use of
@@ -28,3 +42,57 @@ type LineProcessorFunc func([]byte, LineMetadata) ([]byte, error)
 func (f LineProcessorFunc) Process(line []byte, metadata LineMetadata) (out []byte, err error) {
 	return f(line, metadata)
 }
+
+// LineProcessorFactory is an optional interface of LineProcessor for processors
+// with per-worker state, e.g. decoders or output buffers.
+//
+// If the LineProcessor of a Worker implements it, NewWorker calls
+// NewLineProcessor once and the Worker uses the returned LineProcessor for all
+// of its lines. Since it is never called concurrently, it needs no locking.
+// If the returned LineProcessor implements io.Closer, it is closed once the
+// Worker exits.
+type LineProcessorFactory interface {
+	NewLineProcessor(workerId int) LineProcessor
+}
+
+// ChunkProcessor is the alternative to LineProcessor for processors that work
+// on all lines of a chunk at once, e.g. to insert them in bulk.
+//
+// ProcessChunk gets all lines of the chunk, which are slices of the Worker's
+// read buffer and only valid until ProcessChunk returns. Like for
+// LineProcessor, every line ends with the delimiter except the last one.
+// It returns the output of the whole chunk, which should not end with
+// the delimiter unless the last line does. An error fails the chunk,
+// the LineErrorPolicy does not apply.
+//
+// If the LineProcessor of a Worker implements ChunkProcessor, only
+// ProcessChunk is called. ChunkProcessorFunc turns a ChunkProcessor
+// into a LineProcessor, so it can be passed to NewQueue.
+type ChunkProcessor interface {
+	ProcessChunk(lines [][]byte, metadata ChunkMetadata) (out []byte, err error)
+}
+
+// ChunkMetadata is the metadata passed to ChunkProcessor.ProcessChunk.
+type ChunkMetadata struct {
+	WorkerId int
+	Chunk    *Chunk
+	Context  context.Context
+}
+
+// The ChunkProcessorFunc type is an adapter that allows the use of ordinary
+// functions as ChunkProcessor. It is a LineProcessor as well.
+type ChunkProcessorFunc func([][]byte, ChunkMetadata) ([]byte, error)
+
+// ProcessChunk calls the underlying ChunkProcessorFunc.
+func (f ChunkProcessorFunc) ProcessChunk(lines [][]byte, metadata ChunkMetadata) (out []byte, err error) {
+	return f(lines, metadata)
+}
+
+// Process calls the underlying ChunkProcessorFunc with line as the only line.
+func (f ChunkProcessorFunc) Process(line []byte, metadata LineMetadata) (out []byte, err error) {
+	return f([][]byte{line}, ChunkMetadata{
+		WorkerId: metadata.WorkerId,
+		Chunk:    metadata.Chunk,
+		Context:  metadata.Context,
+	})
+}
@@ -1,6 +1,11 @@
 package conveyor_test
 
 import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/fgehrlicher/conveyor"
@@ -16,3 +21,149 @@ func TestLineProcessorFunc(t *testing.T) {
 	out, _ := testFunc.Process(testData, conveyor.LineMetadata{})
 	assert.Equal(t, testData, out)
 }
+
+// workerUpperProcessor converts lines to upper case with a buffer
+// that is owned by a single worker.
+type workerUpperProcessor struct {
+	sync.Mutex
+	instances map[int]*upperInstance
+}
+
+func (w *workerUpperProcessor) Process([]byte, conveyor.LineMetadata) ([]byte, error) {
+	return nil, errors.New("shared processor must not be used")
+}
+
+func (w *workerUpperProcessor) NewLineProcessor(workerId int) conveyor.LineProcessor {
+	w.Lock()
+	defer w.Unlock()
+
+	instance := &upperInstance{workerId: workerId}
+	w.instances[workerId] = instance
+
+	return instance
+}
+
+type upperInstance struct {
+	workerId int
+	buff     []byte
+	lines    int
+	closed   bool
+	wrongIds int
+}
+
+func (u *upperInstance) Process(line []byte, metadata conveyor.LineMetadata) ([]byte, error) {
+	if metadata.WorkerId != u.workerId || u.closed {
+		u.wrongIds++
+	}
+
+	u.lines++
+	u.buff = append(u.buff[:0], bytes.ToUpper(line)...)
+
+	return u.buff, nil
+}
+
+func (u *upperInstance) Close() error {
+	u.closed = true
+	return nil
+}
+
+func TestLineProcessorFactory(t *testing.T) {
+	assertion := assert.New(t)
+	workers := 4
+
+	content, err := ioutil.ReadFile("testdata/data.txt")
+	assertion.NoError(err)
+
+	processor := &workerUpperProcessor{instances: make(map[int]*upperInstance)}
+	out := &bytes.Buffer{}
+
+	chunks, err := conveyor.GetChunksFromFile("testdata/data.txt", 512, conveyor.NewConcurrentWriter(out, true))
+	assertion.NoError(err)
+
+	result := conveyor.NewQueue(chunks, workers, processor, &conveyor.QueueOpts{
+		Logger:    NullLogger(),
+		ErrLogger: NullLogger(),
+	}).Work()
+
+	assertion.Empty(result.FailedChunks)
+	assertion.Equal(string(bytes.ToUpper(content)), out.String())
+	assertion.Len(processor.instances, workers)
+
+	var lines int
+	for _, instance := range processor.instances {
+		assertion.True(instance.closed)
+		assertion.Zero(instance.wrongIds)
+		lines += instance.lines
+	}
+
+	assertion.Equal(int(result.Lines), lines)
+}
+
+func TestChunkProcessor(t *testing.T) {
+	assertion := assert.New(t)
+
+	content, err := ioutil.ReadFile("testdata/data.txt")
+	assertion.NoError(err)
+
+	var (
+		calls int64
+		lines int64
+	)
+
+	processor := conveyor.ChunkProcessorFunc(func(chunkLines [][]byte, metadata conveyor.ChunkMetadata) ([]byte, error) {
+		atomic.AddInt64(&calls, 1)
+		atomic.AddInt64(&lines, int64(len(chunkLines)))
+
+		return bytes.ToUpper(bytes.Join(chunkLines, nil)), nil
+	})
+
+	out := &bytes.Buffer{}
+	chunks, err := conveyor.GetChunksFromFile("testdata/data.txt", 512, conveyor.NewConcurrentWriter(out, true))
+	assertion.NoError(err)
+
+	result := conveyor.NewQueue(chunks, 4, processor, &conveyor.QueueOpts{
+		Logger:    NullLogger(),
+		ErrLogger: NullLogger(),
+	}).Work()
+
+	assertion.Empty(result.FailedChunks)
+	assertion.Equal(string(bytes.ToUpper(content)), out.String())
+	assertion.Equal(int64(len(chunks)), atomic.LoadInt64(&calls))
+	assertion.Equal(int64(bytes.Count(content, []byte{'\n'})), result.Lines)
+	assertion.Equal(result.Lines, atomic.LoadInt64(&lines))
+
+	single, err := processor.Process([]byte("abc\n"), conveyor.LineMetadata{})
+	assertion.NoError(err)
+	assertion.Equal("ABC\n", string(single))
+}
+
+func TestChunkProcessorError(t *testing.T) {
+	assertion := assert.New(t)
+	expectedErr := errors.New("test error")
+
+	processor := conveyor.ChunkProcessorFunc(func(lines [][]byte, metadata conveyor.ChunkMetadata) ([]byte, error) {
+		if metadata.Chunk.Id == 2 {
+			return nil, expectedErr
+		}
+
+		return bytes.Join(lines, nil), nil
+	})
+
+	chunks, err := conveyor.GetChunksFromFile("testdata/data.txt", 512, nil)
+	assertion.NoError(err)
+
+	result := conveyor.NewQueue(chunks, 4, processor, &conveyor.QueueOpts{
+		Logger:          NullLogger(),
+		ErrLogger:       NullLogger(),
+		LineErrorPolicy: conveyor.SkipLine,
+	}).Work()
+
+	assertion.Equal(1, result.FailedChunks)
+	for _, chunkResult := range result.Results {
+		if chunkResult.Chunk.Id == 2 {
+			assertion.ErrorIs(chunkResult.Err, expectedErr)
+		} else {
+			assertion.NoError(chunkResult.Err)
+		}
+	}
+}
@@ -1,20 +1,54 @@
 package conveyor
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ErrQueueClosed is returned when chunks are submitted to a closed or stopped Queue.
+var ErrQueueClosed = errors.New("queue is closed")
+
+// ErrInvalidChunkSize is returned when a submitted chunk does not have
+// the chunk size of the Queue.
+var ErrInvalidChunkSize = errors.New("invalid chunk size")
+
 type Queue struct {
+	chunkCount    int64
 	workers       int
-	chunkCount    int
 	chunkSize     int64
 	lineProcessor LineProcessor
 	*QueueOpts
 
-	tasks  chan Chunk
-	result chan ChunkResult
+	tasks    chan Chunk
+	result   chan ChunkResult
+	restored []ChunkResult
+	// initErr aborts the run before any chunk is processed.
+	initErr error
+
+	results   chan ChunkResult
+	summary   QueueResult
+	doneHooks queueDoneHooks
+
+	submitLock  sync.Mutex
+	stopped     chan struct{}
+	lastChunkId int
+
+	// pending is the number of queued chunks without a final result,
+	// including chunks that wait for a retry. The tasks channel is closed
+	// once the Queue is closed and no chunk is pending.
+	stateLock   sync.Mutex
+	closed      bool
+	tasksClosed bool
+	pending     int
+	retries     sync.WaitGroup
+	abandoned   []ChunkResult
 }
 
 type QueueOpts struct {
@@ -22,21 +56,120 @@ type QueueOpts struct {
 	Logger               *log.Logger
 	ErrLogger            *log.Logger
 	OverflowScanBuffSize int
+
+	// MaxLineSize limits the size of a single line without its delimiter.
+	// A chunk with a longer line fails with ErrLineTooLong. Lines may be longer
+	// than the chunk size, so the chunk that contains the start of a line
+	// reads as far beyond its end as required. MaxLineSize bounds the memory
+	// of those reads. 0 means no limit.
+	MaxLineSize int
+
+	// Delimiter separates the records of the input. The default is LF.
+	// Output written by a ConcurrentWriter should use the same Delimiter,
+	// see NewConcurrentWriter. If the Delimiter has a Quote, the chunks passed
+	// to NewQueue or Submit must be prepared by ScanQuotes. Queue.SubmitReader,
+	// Queue.SubmitStream and Queue.SubmitFile take care of it.
+	Delimiter Delimiter
+
+	// FailurePolicy is consulted after every processed chunk and aborts
+	// the run once it returns an error. A nil FailurePolicy never aborts.
+	FailurePolicy FailurePolicy
+
+	// LineErrorPolicy defines how errors returned by the LineProcessor are
+	// handled. LineErrorReplacer is only used by the ReplaceLine policy.
+	LineErrorPolicy   LineErrorPolicy
+	LineErrorReplacer LineErrorReplacer
+
+	// DeadLetter receives the raw content of every line the LineProcessor
+	// failed for, regardless of the LineErrorPolicy. Chunk.DeadLetter takes
+	// precedence over it. The records are formatted by DeadLetterFormatter.
+	DeadLetter          ChunkWriter
+	DeadLetterFormatter DeadLetterFormatter
+
+	// Repanic disables the recovery of panics during the processing of a
+	// chunk, e.g. for debugging. By default a panic fails the chunk with a
+	// PanicError and the Worker continues with the next chunk.
+	Repanic bool
+
+	// RetryPolicy processes failed chunks again. A nil RetryPolicy
+	// never retries.
+	RetryPolicy *RetryPolicy
+
+	// NumberLines sets Chunk.StartLine for all chunks, so
+	// LineMetadata.AbsoluteLine is set. Seekable inputs are read twice for
+	// it, see NumberLines. The chunks passed to NewQueue or Submit are
+	// numbered by NumberLines unless all of them have a StartLine already,
+	// so every Submit must pass all chunks of its ChunkReaders.
+	NumberLines bool
+
+	// Checkpoint records every completed chunk. Chunks that are already
+	// marked as completed are skipped and restored from the Checkpoint.
+	Checkpoint *Checkpoint
 }
 
 type QueueResult struct {
-	Results      []ChunkResult
-	Lines        int64
-	FailedChunks int
+	Results           []ChunkResult
+	Lines             int64
+	FailedChunks      int
+	UnprocessedChunks int
+
+	// Err is set if the run was aborted, either because the context
+	// was done or because the FailurePolicy returned an error. It is also
+	// set if a QueueDoneHook returned an error.
+	Err error
 }
 
+// NewQueue returns a Queue for the given chunks. The Queue is done once all
+// chunks are processed, a Queue without chunks is done right away.
+// With QueueOpts.Checkpoint, every ChunkWriter that keeps the order must
+// be a ConcurrentWriter prepared by ConcurrentWriter.Resume, otherwise
+// the run fails without processing any chunk. Ordered dead letter writers
+// may be new ConcurrentWriters instead, they continue after the restored
+// chunks, so their output should be opened for appending. The run fails
+// the same way if QueueOpts.NumberLines is set and the lines can not be counted.
 func NewQueue(chunks []Chunk, workers int, lineProcessor LineProcessor, opts ...*QueueOpts) *Queue {
-	tasks := make(chan Chunk, len(chunks))
+	var chunkSize int
+	if len(chunks) > 0 {
+		chunkSize = chunks[0].Size
+	}
+
+	queue := newQueue(workers, chunkSize, len(chunks), lineProcessor, opts)
+	chunks, queue.initErr = queue.numberLines(chunks)
+
+	if queue.Checkpoint != nil && queue.initErr == nil {
+		queue.initErr = queue.Checkpoint.checkWriters(chunks, queue.QueueOpts)
+	}
+
 	for _, chunk := range chunks {
-		tasks <- chunk
+		if queue.Checkpoint != nil && queue.initErr == nil {
+			if result, ok := queue.Checkpoint.restore(chunk, queue.QueueOpts); ok {
+				queue.restored = append(queue.restored, result)
+				continue
+			}
+		}
+
+		queue.tasks <- chunk
+		queue.pending++
 	}
-	close(tasks)
 
+	queue.chunkCount = int64(len(chunks))
+	queue.lastChunkId = len(chunks)
+	queue.Close()
+
+	return queue
+}
+
+// NewDynamicQueue returns a Queue without any chunks. Chunks are added with
+// Queue.Submit or Queue.SubmitReader while the Queue is running, which allows
+// a single set of workers to serve many files. All chunks must have the
+// given chunkSize. The Queue is done once Queue.Close was called and all
+// submitted chunks are processed.
+// QueueOpts.Checkpoint is not supported for submitted chunks.
+func NewDynamicQueue(workers int, chunkSize int, lineProcessor LineProcessor, opts ...*QueueOpts) *Queue {
+	return newQueue(workers, chunkSize, workers, lineProcessor, opts)
+}
+
+func newQueue(workers int, chunkSize int, capacity int, lineProcessor LineProcessor, opts []*QueueOpts) *Queue {
 	var opt *QueueOpts
 	if len(opts) > 0 && opts[0] != nil {
 		opt = opts[0]
@@ -48,6 +181,12 @@ func NewQueue(chunks []Chunk, workers int, lineProcessor LineProcessor, opts ...
 		opt.ChunkResultLogger = DefaultChunkResultLogger
 	}
 
+	if opt.DeadLetterFormatter == nil {
+		opt.DeadLetterFormatter = DefaultDeadLetterFormatter
+	}
+
+	opt.Delimiter = opt.Delimiter.orDefault()
+
 	if opt.OverflowScanBuffSize == 0 {
 		opt.OverflowScanBuffSize = DefaultOverflowScanSize
 	}
@@ -62,22 +201,290 @@ func NewQueue(chunks []Chunk, workers int, lineProcessor LineProcessor, opts ...
 
 	return &Queue{
 		workers:       workers,
-		tasks:         tasks,
+		tasks:         make(chan Chunk, capacity),
 		result:        make(chan ChunkResult, workers),
-		chunkCount:    len(chunks),
-		chunkSize:     int64(chunks[0].Size),
+		results:       make(chan ChunkResult, workers),
+		stopped:       make(chan struct{}),
+		chunkSize:     int64(chunkSize),
 		lineProcessor: lineProcessor,
 		QueueOpts:     opt,
 	}
 }
 
-func (queue *Queue) Work() QueueResult {
+// Submit adds chunks to the Queue. It blocks until all chunks are queued and
+// returns ErrQueueClosed if the Queue was closed or its run was stopped.
+// With QueueOpts.NumberLines, the chunks are numbered first.
+// Chunks that could not be queued are not part of the results.
+func (queue *Queue) Submit(chunks ...Chunk) error {
+	queue.submitLock.Lock()
+	defer queue.submitLock.Unlock()
+
+	chunks, err := queue.numberLines(chunks)
+	if err != nil {
+		return err
+	}
+
+	return queue.submit(chunks)
+}
+
+// SubmitReader splits in into chunks of the Queue's chunk size and adds them
+// to the Queue. The chunk ids continue after the highest id submitted so far,
+// so they are unique across all readers.
+func (queue *Queue) SubmitReader(in ChunkReader, out ChunkWriter) error {
+	queue.submitLock.Lock()
+	defer queue.submitLock.Unlock()
+
+	chunks, err := getChunksFromReader(in, int(queue.chunkSize), queue.lastChunkId+1, out)
+	if err != nil {
+		return err
+	}
+
+	if queue.Delimiter.Quote != 0 {
+		if err = ScanQuotes(chunks, queue.Delimiter.Quote); err != nil {
+			return err
+		}
+	}
+
+	if chunks, err = queue.numberLines(chunks); err != nil {
+		return err
+	}
+
+	return queue.submit(chunks)
+}
+
+// SubmitStream splits the non seekable stream r into chunks and adds them to
+// the Queue in stream order, see ChunkStream. name is used to identify the
+// stream. Like for SubmitReader the chunk ids continue after the highest id
+// submitted so far.
+func (queue *Queue) SubmitStream(r io.Reader, name string, out ChunkWriter) error {
+	queue.submitLock.Lock()
+	defer queue.submitLock.Unlock()
+
 	var (
-		wg      sync.WaitGroup
-		results = make([]ChunkResult, 0, queue.chunkCount)
+		counter       = &lineCounter{delimiter: queue.Delimiter.orDefault()}
+		line    int64 = 1
+	)
+	defer counter.close()
+
+	return ChunkStream(r, name, int(queue.chunkSize), queue.lastChunkId+1, out, queue.Delimiter, func(chunks ...Chunk) error {
+		if queue.NumberLines {
+			for i := range chunks {
+				lines, err := counter.count(&chunks[i], nil)
+				if err != nil {
+					return err
+				}
+
+				chunks[i].StartLine = line
+				line += lines
+			}
+		}
+
+		return queue.submit(chunks)
+	})
+}
+
+// SubmitFile adds the file at path to the Queue. Compressed files are detected
+// by their file extension. BGZF and seekable zstd files are split into chunks
+// that are decompressed in parallel by the workers, all other compressed
+// files are decompressed sequentially and submitted in stream order.
+func (queue *Queue) SubmitFile(path string, out ChunkWriter) error {
+	compression := CompressionFromPath(path)
+	if compression == NoCompression {
+		return queue.SubmitReader(&FileReader{FilePath: path}, out)
+	}
+
+	frameReader, err := OpenFrameReader(path)
+	if err == nil {
+		return queue.SubmitReader(frameReader, out)
+	}
+
+	if !errors.Is(err, ErrNotSeekable) {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decompressor, err := NewDecompressor(file, compression)
+	if err != nil {
+		return err
+	}
+	defer decompressor.Close()
+
+	return queue.SubmitStream(decompressor, path, out)
+}
+
+func (queue *Queue) submit(chunks []Chunk) error {
+	for _, chunk := range chunks {
+		if queue.closed {
+			return ErrQueueClosed
+		}
+
+		if int64(chunk.Size) != queue.chunkSize && !chunk.Aligned {
+			return fmt.Errorf("%w: chunk %d has size %d", ErrInvalidChunkSize, chunk.Id, chunk.Size)
+		}
+
+		queue.addPending(1)
+
+		select {
+		case queue.tasks <- chunk:
+		case <-queue.stopped:
+			queue.addPending(-1)
+			return ErrQueueClosed
+		}
+
+		atomic.AddInt64(&queue.chunkCount, 1)
+		if chunk.Id > queue.lastChunkId {
+			queue.lastChunkId = chunk.Id
+		}
+	}
+
+	return nil
+}
+
+// numberLines sets Chunk.StartLine of a copy of chunks if QueueOpts.NumberLines
+// is set, unless all chunks have a StartLine already.
+func (queue *Queue) numberLines(chunks []Chunk) ([]Chunk, error) {
+	if !queue.NumberLines {
+		return chunks, nil
+	}
+
+	numbered := true
+	for _, chunk := range chunks {
+		numbered = numbered && chunk.StartLine > 0
+	}
+
+	if numbered {
+		return chunks, nil
+	}
+
+	chunks = append([]Chunk(nil), chunks...)
+	return chunks, NumberLines(chunks, queue.workers, queue.Delimiter)
+}
+
+// Close marks the Queue as complete. No more chunks can be submitted and the
+// workers stop once all submitted chunks are processed.
+func (queue *Queue) Close() {
+	queue.submitLock.Lock()
+	defer queue.submitLock.Unlock()
+
+	queue.stateLock.Lock()
+	queue.closed = true
+	queue.stateLock.Unlock()
+
+	queue.closeTasks(false)
+}
+
+// addPending adds delta to the number of pending chunks and closes the
+// tasks channel if no chunk is pending anymore.
+func (queue *Queue) addPending(delta int) {
+	queue.stateLock.Lock()
+	queue.pending += delta
+	queue.stateLock.Unlock()
+
+	if delta < 0 {
+		queue.closeTasks(false)
+	}
+}
+
+// closeTasks closes the tasks channel of a closed Queue once no chunk is
+// pending, or right away if force is set.
+func (queue *Queue) closeTasks(force bool) {
+	queue.stateLock.Lock()
+	defer queue.stateLock.Unlock()
+
+	if queue.tasksClosed || !queue.closed || (queue.pending > 0 && !force) {
+		return
+	}
+
+	queue.tasksClosed = true
+	close(queue.tasks)
+}
+
+// retry adds chunk to the Queue again once the backoff of the RetryPolicy
+// has passed. The chunk stays pending until its next attempt is done.
+func (queue *Queue) retry(ctx context.Context, result ChunkResult) {
+	chunk := result.Chunk
+	chunk.attempts = result.Attempts
+	delay := queue.RetryPolicy.backoff(result.Attempts)
+
+	queue.ErrLogger.Printf(
+		"chunk %d failed in attempt %d of %d, retrying in %s: %s",
+		chunk.Id,
+		result.Attempts,
+		queue.RetryPolicy.MaxAttempts,
+		delay,
+		result.Err,
 	)
 
-	wg.Add(queue.workers + queue.chunkCount)
+	queue.retries.Add(1)
+	go func() {
+		defer queue.retries.Done()
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			select {
+			case queue.tasks <- chunk:
+				return
+			case <-ctx.Done():
+			}
+		case <-ctx.Done():
+		}
+
+		// The run was stopped before the next attempt, so the
+		// failed attempt is the final result of the chunk.
+		queue.stateLock.Lock()
+		queue.abandoned = append(queue.abandoned, result)
+		queue.stateLock.Unlock()
+	}()
+}
+
+// ChunkCount returns the number of chunks added to the Queue.
+func (queue *Queue) ChunkCount() int {
+	return int(atomic.LoadInt64(&queue.chunkCount))
+}
+
+func (queue *Queue) Work() QueueResult {
+	return queue.WorkContext(context.Background())
+}
+
+// WorkContext works like Work but stops as soon as ctx is done or the
+// FailurePolicy aborts the run. Workers stop pulling new chunks and abort
+// the chunk they are currently processing. Every chunk that was not processed
+// is part of QueueResult.Results with an ErrChunkNotProcessed error.
+func (queue *Queue) WorkContext(ctx context.Context) QueueResult {
+	results := make([]ChunkResult, 0, queue.ChunkCount())
+
+	queue.Start(ctx)
+	for result := range queue.Results() {
+		results = append(results, result)
+	}
+
+	queueResult := queue.Wait()
+	queueResult.Results = results
+
+	return queueResult
+}
+
+// Start starts the workers and returns immediately. The ChunkResult of every
+// chunk is sent to the channel returned by Results as soon as it is available.
+// Start must only be called once and the results must be received, otherwise
+// the workers block. Cancellation works like for WorkContext.
+func (queue *Queue) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	ctx, cancel := context.WithCancel(ctx)
+	if queue.initErr != nil {
+		cancel()
+	}
+
+	wg.Add(queue.workers)
 
 	for i := 0; i < queue.workers; i++ {
 		go NewWorker(
@@ -88,47 +495,159 @@ func (queue *Queue) Work() QueueResult {
 			queue.chunkSize,
 			queue.OverflowScanBuffSize,
 			&wg,
-		).Work()
+			queue.QueueOpts,
+		).WorkContext(ctx)
 	}
 
-	quit := make(chan int)
 	go func() {
-		currentChunkNumber := 0
+		wg.Wait()
+		close(queue.result)
+	}()
 
-		for {
-			select {
-			case result := <-queue.result:
-				currentChunkNumber++
+	go queue.collect(ctx, cancel)
+}
 
-				queue.ChunkResultLogger(queue, result, currentChunkNumber)
+// Results returns the channel of all ChunkResult. It is closed once all
+// chunks are done.
+func (queue *Queue) Results() <-chan ChunkResult {
+	return queue.results
+}
 
-				results = append(results, result)
-				wg.Done()
+// Wait blocks until all chunks are done and returns the summary of the run.
+// Results that were not received yet are discarded. QueueResult.Results is
+// always empty, since the results are only streamed via Results.
+func (queue *Queue) Wait() QueueResult {
+	for range queue.results {
+	}
 
-			case <-quit:
-				return
-			}
-		}
-	}()
+	return queue.summary
+}
 
-	wg.Wait()
-	quit <- 0
+// collect receives the results from the workers, logs and records them and
+// passes them on to Queue.results. Once all workers are done, every
+// remaining chunk is passed on as not processed.
+func (queue *Queue) collect(ctx context.Context, cancel context.CancelFunc) {
+	defer close(queue.results)
+	defer cancel()
 
 	var (
-		totalLines   int64
-		failedChunks int
+		abortErr = queue.initErr
+		recorder *checkpointRecorder
 	)
 
-	for _, result := range results {
-		totalLines += int64(result.Lines)
+	if queue.Checkpoint != nil {
+		recorder = newCheckpointRecorder(queue.Checkpoint, queue.QueueOpts)
+	}
+
+	queue.doneHooks.add(queue.lineProcessor)
+
+	for _, result := range queue.restored {
+		queue.emit(result)
+	}
+
+	currentChunkNumber, failedChunks := len(queue.restored), 0
+	for result := range queue.result {
+		if !result.Processed() {
+			queue.emit(result)
+			queue.addPending(-1)
+			continue
+		}
+
+		if abortErr == nil && ctx.Err() == nil && queue.RetryPolicy.retries(result) {
+			queue.retry(ctx, result)
+			continue
+		}
+
+		queue.writeDeadLetters(&result)
+
+		currentChunkNumber++
+		queue.ChunkResultLogger(queue, result, currentChunkNumber)
+
 		if !result.Ok() {
 			failedChunks++
 		}
+
+		if recorder != nil && result.Ok() {
+			if err := recorder.record(result); err != nil {
+				if abortErr == nil {
+					abortErr = fmt.Errorf("error while recording checkpoint: %w", err)
+				}
+
+				recorder = nil
+				cancel()
+			}
+		}
+
+		if queue.FailurePolicy != nil && abortErr == nil {
+			abortErr = queue.FailurePolicy(failedChunks, currentChunkNumber, queue.ChunkCount())
+			if abortErr != nil {
+				cancel()
+			}
+		}
+
+		queue.emit(result)
+		queue.addPending(-1)
+	}
+
+	close(queue.stopped)
+	queue.retries.Wait()
+	queue.Close()
+	queue.closeTasks(true)
+
+	for chunk := range queue.tasks {
+		queue.emit(ChunkResult{
+			Chunk:    chunk,
+			Err:      notProcessedErr(ctx.Err()),
+			Attempts: chunk.attempts,
+		})
+	}
+
+	for _, result := range queue.abandoned {
+		queue.writeDeadLetters(&result)
+		queue.emit(result)
+	}
+
+	switch {
+	case abortErr != nil:
+		queue.summary.Err = abortErr
+	case queue.summary.UnprocessedChunks > 0 || len(queue.abandoned) > 0:
+		queue.summary.Err = ctx.Err()
 	}
 
-	return QueueResult{
-		Results:      results,
-		Lines:        totalLines,
-		FailedChunks: failedChunks,
+	if err := queue.doneHooks.call(queue.summary); err != nil && queue.summary.Err == nil {
+		queue.summary.Err = err
 	}
 }
+
+// writeDeadLetters writes the dead letters the Worker held back for result,
+// which is the final result of its chunk.
+func (queue *Queue) writeDeadLetters(result *ChunkResult) {
+	if !result.holdsDeadLetters {
+		return
+	}
+
+	out := deadLetterWriter(&result.Chunk, queue.QueueOpts)
+	if err := out.Write(&result.Chunk, result.deadLetters); err != nil {
+		queue.ErrLogger.Printf("chunk %d: error while writing dead letters: %s", result.Chunk.Id, err)
+	}
+
+	result.deadLetters = nil
+	result.holdsDeadLetters = false
+}
+
+// emit adds result to the summary and passes it on to Queue.results.
+func (queue *Queue) emit(result ChunkResult) {
+	queue.doneHooks.add(result.Chunk.Out)
+
+	switch {
+	case !result.Processed():
+		queue.summary.UnprocessedChunks++
+	case !result.Ok():
+		queue.summary.Lines += int64(result.Lines)
+		queue.summary.FailedChunks++
+	default:
+		queue.summary.Lines += int64(result.Lines)
+	}
+
+	queue.results <- result
+}
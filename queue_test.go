@@ -2,8 +2,11 @@ package conveyor_test
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"log"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/fgehrlicher/conveyor"
@@ -99,6 +102,35 @@ func TestQueueDefaultOptions(t *testing.T) {
 	assertion.Equal(conveyor.DefaultOverflowScanSize, queue.OverflowScanBuffSize)
 }
 
+func TestQueueProcessesEmptyFile(t *testing.T) {
+	var (
+		assertion = assert.New(t)
+		testFile  = filepath.Join(t.TempDir(), "empty.txt")
+	)
+
+	assertion.NoError(ioutil.WriteFile(testFile, nil, 0644))
+
+	chunks, err := conveyor.GetChunksFromFile(testFile, 64, nil)
+	assertion.NoError(err)
+
+	plan, err := conveyor.PlanChunks([]string{testFile}, 64, nil)
+	assertion.NoError(err)
+
+	lineChunks, err := conveyor.GetLineChunksFromFile(testFile, 10, nil)
+	assertion.NoError(err)
+
+	for _, chunks := range [][]conveyor.Chunk{chunks, plan.Chunks, lineChunks} {
+		result := conveyor.NewQueue(chunks, 4, NullLineProcessor, &conveyor.QueueOpts{
+			Logger:    NullLogger(),
+			ErrLogger: NullLogger(),
+		}).Work()
+
+		assertion.NoError(result.Err)
+		assertion.Empty(result.Results)
+		assertion.Zero(result.Lines)
+	}
+}
+
 func TestQueueFailsForInvalidChunks(t *testing.T) {
 	assertion := assert.New(t)
 	chunks := 10
@@ -119,25 +151,258 @@ func TestQueueFailsForInvalidChunks(t *testing.T) {
 	}
 }
 
-func TestQueueErrorsForTooSmallChunks(t *testing.T) {
+func TestQueueHandlesLinesLongerThanChunkSize(t *testing.T) {
+	var (
+		assertion = assert.New(t)
+		testFile  = filepath.Join(t.TempDir(), "lines.txt")
+		content   strings.Builder
+	)
+
+	for i := 1; i <= 60; i++ {
+		content.WriteString(strings.Repeat(string(rune('a'+i%26)), i*i%97+1))
+		content.WriteString("\n")
+	}
+
+	assertion.NoError(ioutil.WriteFile(testFile, []byte(content.String()), 0644))
+
+	for _, chunkSize := range []int{1, 3, 10, 37, 256} {
+		out := &bytes.Buffer{}
+		chunks, err := conveyor.GetChunksFromFile(testFile, chunkSize, conveyor.NewConcurrentWriter(out, true))
+		assertion.NoError(err)
+
+		result := conveyor.NewQueue(
+			chunks,
+			4,
+			NullLineProcessor,
+			&conveyor.QueueOpts{
+				Logger:    NullLogger(),
+				ErrLogger: NullLogger(),
+			},
+		).Work()
+
+		assertion.Len(result.Results, len(chunks))
+		assertion.Empty(result.FailedChunks)
+		assertion.Equal(int64(60), result.Lines)
+		assertion.Equal(content.String(), out.String())
+	}
+}
+
+func TestQueueMaxLineSize(t *testing.T) {
+	var (
+		assertion = assert.New(t)
+		testFile  = filepath.Join(t.TempDir(), "long_lines.txt")
+		longLine  = strings.Repeat("x", 5000)
+	)
+
+	assertion.NoError(ioutil.WriteFile(testFile, []byte("short\n"+longLine+"\nshort\n"), 0644))
+
+	for _, maxLineSize := range []int{0, 5000, 4999} {
+		out := &bytes.Buffer{}
+		chunks, err := conveyor.GetChunksFromFile(testFile, 64, conveyor.NewConcurrentWriter(out, true))
+		assertion.NoError(err)
+
+		result := conveyor.NewQueue(chunks, 4, NullLineProcessor, &conveyor.QueueOpts{
+			Logger:      NullLogger(),
+			ErrLogger:   NullLogger(),
+			MaxLineSize: maxLineSize,
+		}).Work()
+
+		if maxLineSize == 4999 {
+			assertion.Equal(1, result.FailedChunks)
+			for _, chunkResult := range result.Results {
+				if chunkResult.Chunk.Id == 1 {
+					assertion.ErrorIs(chunkResult.Err, conveyor.ErrLineTooLong)
+				}
+			}
+
+			continue
+		}
+
+		assertion.Empty(result.FailedChunks)
+		assertion.Equal(int64(3), result.Lines)
+		assertion.Equal("short\n"+longLine+"\nshort\n", out.String())
+
+		for _, chunkResult := range result.Results {
+			if chunkResult.Chunk.Id > 1 && chunkResult.Chunk.Offset+64 <= 5006 {
+				assertion.Zero(chunkResult.Lines)
+				assertion.Zero(chunkResult.RealSize)
+			}
+		}
+	}
+}
+
+func TestQueueWorkContextReturnsUnprocessedChunks(t *testing.T) {
 	var (
 		assertion = assert.New(t)
 		testFile  = "testdata/data.txt"
 	)
 
-	chunks, err := conveyor.GetChunksFromFile(testFile, 10, nil)
+	chunks, err := conveyor.GetChunksFromFile(testFile, 512, nil)
 	assertion.NoError(err)
 
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
 	result := conveyor.NewQueue(
 		chunks,
 		4,
-		conveyor.LineProcessorFunc(Redact),
+		NullLineProcessor,
 		&conveyor.QueueOpts{
 			Logger:    NullLogger(),
 			ErrLogger: NullLogger(),
 		},
-	).Work()
+	).WorkContext(ctx)
+
+	assertion.ErrorIs(result.Err, context.Canceled)
+	assertion.Equal(len(chunks), len(result.Results))
+	assertion.Equal(len(chunks), result.UnprocessedChunks)
+	assertion.Empty(result.FailedChunks)
+	assertion.Empty(result.Lines)
+
+	for _, chunk := range result.Results {
+		assertion.False(chunk.Processed())
+		assertion.ErrorIs(chunk.Err, conveyor.ErrChunkNotProcessed)
+	}
+}
+
+func TestQueueWorkContextStopsAfterCancel(t *testing.T) {
+	var (
+		assertion = assert.New(t)
+		testFile  = "testdata/data.txt"
+		cancelAt  = 3
+	)
+
+	chunks, err := conveyor.GetChunksFromFile(testFile, 512, nil)
+	assertion.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	result := conveyor.NewQueue(
+		chunks,
+		1,
+		conveyor.LineProcessorFunc(func(line []byte, metadata conveyor.LineMetadata) ([]byte, error) {
+			if metadata.Chunk.Id == cancelAt {
+				cancel()
+				return nil, metadata.Context.Err()
+			}
+
+			return line, nil
+		}),
+		&conveyor.QueueOpts{
+			Logger:    NullLogger(),
+			ErrLogger: NullLogger(),
+		},
+	).WorkContext(ctx)
+
+	assertion.ErrorIs(result.Err, context.Canceled)
+	assertion.Equal(len(chunks), len(result.Results))
+	assertion.Equal(len(chunks)-cancelAt+1, result.UnprocessedChunks)
+	assertion.Empty(result.FailedChunks)
+
+	for _, chunk := range result.Results {
+		assertion.Equal(chunk.Chunk.Id < cancelAt, chunk.Processed())
+	}
+}
+
+func TestQueueStreamsResults(t *testing.T) {
+	var (
+		assertion = assert.New(t)
+		testFile  = "testdata/data.txt"
+	)
+
+	chunks, err := conveyor.GetChunksFromFile(testFile, 512, nil)
+	assertion.NoError(err)
+
+	queue := conveyor.NewQueue(
+		chunks,
+		4,
+		NullLineProcessor,
+		&conveyor.QueueOpts{
+			Logger:    NullLogger(),
+			ErrLogger: NullLogger(),
+		},
+	)
+
+	queue.Start(context.Background())
+
+	var (
+		lines int
+		ids   = make(map[int]bool)
+	)
+
+	for result := range queue.Results() {
+		assertion.True(result.Ok())
+		lines += result.Lines
+		ids[result.Chunk.Id] = true
+	}
+
+	summary := queue.Wait()
+
+	assertion.Len(ids, len(chunks))
+	assertion.Equal(100, lines)
+	assertion.Equal(int64(100), summary.Lines)
+	assertion.Empty(summary.FailedChunks)
+	assertion.Empty(summary.Results)
+	assertion.NoError(summary.Err)
+}
+
+func TestDynamicQueueProcessesSubmittedChunks(t *testing.T) {
+	assertion := assert.New(t)
+
+	buff := &bytes.Buffer{}
+	writer := conveyor.NewConcurrentWriter(buff, true)
+
+	queue := conveyor.NewDynamicQueue(
+		4,
+		512,
+		NullLineProcessor,
+		&conveyor.QueueOpts{
+			Logger:    NullLogger(),
+			ErrLogger: NullLogger(),
+		},
+	)
+
+	queue.Start(context.Background())
+
+	var (
+		ids   = make(map[int]bool)
+		lines int
+		done  = make(chan struct{})
+	)
+
+	go func() {
+		defer close(done)
+
+		for result := range queue.Results() {
+			assertion.True(result.Ok())
+			assertion.False(ids[result.Chunk.Id])
+			ids[result.Chunk.Id] = true
+			lines += result.Lines
+		}
+	}()
+
+	assertion.NoError(queue.SubmitReader(&conveyor.FileReader{FilePath: "testdata/data.txt"}, writer))
+	assertion.NoError(queue.SubmitReader(&conveyor.FileReader{FilePath: "testdata/5_lines.txt"}, writer))
+	assertion.ErrorIs(
+		queue.Submit(conveyor.Chunk{Id: 100, Size: 100}),
+		conveyor.ErrInvalidChunkSize,
+	)
+
+	queue.Close()
+	assertion.ErrorIs(queue.SubmitReader(&conveyor.FileReader{FilePath: "testdata/data.txt"}, writer), conveyor.ErrQueueClosed)
+
+	<-done
+	summary := queue.Wait()
+
+	assertion.Equal(queue.ChunkCount(), len(ids))
+	assertion.Equal(105, lines)
+	assertion.Equal(int64(105), summary.Lines)
+
+	data, err := ioutil.ReadFile("testdata/data.txt")
+	assertion.NoError(err)
+	fiveLines, err := ioutil.ReadFile("testdata/5_lines.txt")
+	assertion.NoError(err)
 
-	assertion.Equal(694, len(result.Results))
-	assertion.Equal(600, result.FailedChunks)
+	assertion.Equal(string(data)+string(fiveLines), buff.String())
 }
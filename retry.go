@@ -0,0 +1,63 @@
+package conveyor
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryPolicy defines how often and when failed chunks are processed again.
+// A retried chunk is added to the Queue again after the backoff, its failed
+// attempts are not part of the results and not passed to the ChunkWriter,
+// since a chunk's output is only written if the chunk succeeded. Dead letters
+// are only written for the final attempt.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a chunk is processed,
+	// including the first attempt. Values below 2 disable retries.
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry. It doubles with every
+	// further retry, up to MaxBackoff if that is set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Retryable decides whether a failed chunk is retried. If it is nil,
+	// all errors are retried except context errors.
+	Retryable func(err error) bool
+}
+
+// DefaultRetryable is the predicate used if RetryPolicy.Retryable is nil.
+func DefaultRetryable(err error) bool {
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// retries reports whether the failed result should be retried.
+func (r *RetryPolicy) retries(result ChunkResult) bool {
+	if r == nil || result.Ok() || !result.Processed() || result.Attempts >= r.MaxAttempts {
+		return false
+	}
+
+	if r.Retryable == nil {
+		return DefaultRetryable(result.Err)
+	}
+
+	return r.Retryable(result.Err)
+}
+
+// backoff returns the delay before the next attempt after attempts failed attempts.
+func (r *RetryPolicy) backoff(attempts int) time.Duration {
+	delay := r.Backoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+
+		if r.MaxBackoff > 0 && delay >= r.MaxBackoff {
+			break
+		}
+	}
+
+	if r.MaxBackoff > 0 && delay > r.MaxBackoff {
+		delay = r.MaxBackoff
+	}
+
+	return delay
+}
@@ -0,0 +1,232 @@
+package conveyor_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fgehrlicher/conveyor"
+	"github.com/stretchr/testify/assert"
+)
+
+var errTransient = errors.New("transient error")
+
+// flakyProcessor fails the first failures attempts of every chunk in chunkIds.
+type flakyProcessor struct {
+	sync.Mutex
+	chunkIds map[int]bool
+	failures int
+	attempts map[int]int
+}
+
+func newFlakyProcessor(failures int, chunkIds ...int) *flakyProcessor {
+	f := &flakyProcessor{
+		chunkIds: make(map[int]bool),
+		failures: failures,
+		attempts: make(map[int]int),
+	}
+
+	for _, id := range chunkIds {
+		f.chunkIds[id] = true
+	}
+
+	return f
+}
+
+func (f *flakyProcessor) Process(line []byte, metadata conveyor.LineMetadata) ([]byte, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if metadata.Line == 1 {
+		f.attempts[metadata.Chunk.Id]++
+	}
+
+	// Fail in the middle of the chunk, so a part of it is already processed.
+	if metadata.Line == 3 && f.chunkIds[metadata.Chunk.Id] && f.attempts[metadata.Chunk.Id] <= f.failures {
+		return nil, errTransient
+	}
+
+	return line, nil
+}
+
+func TestRetryPolicy(t *testing.T) {
+	assertion := assert.New(t)
+
+	content, err := ioutil.ReadFile("testdata/data.txt")
+	assertion.NoError(err)
+
+	for _, workers := range []int{1, 4} {
+		processor := newFlakyProcessor(2, 2, 5)
+		out := &bytes.Buffer{}
+
+		chunks, err := conveyor.GetChunksFromFile("testdata/data.txt", 512, conveyor.NewConcurrentWriter(out, true))
+		assertion.NoError(err)
+
+		result := conveyor.NewQueue(chunks, workers, processor, &conveyor.QueueOpts{
+			Logger:    NullLogger(),
+			ErrLogger: NullLogger(),
+			RetryPolicy: &conveyor.RetryPolicy{
+				MaxAttempts: 3,
+				Backoff:     time.Millisecond,
+			},
+		}).Work()
+
+		assertion.NoError(result.Err)
+		assertion.Empty(result.FailedChunks)
+		assertion.Len(result.Results, len(chunks))
+		assertion.Equal(string(content), out.String())
+
+		for _, chunkResult := range result.Results {
+			if processor.chunkIds[chunkResult.Chunk.Id] {
+				assertion.Equal(3, chunkResult.Attempts)
+			} else {
+				assertion.Equal(1, chunkResult.Attempts)
+			}
+		}
+	}
+}
+
+func TestRetryPolicyWritesDeadLettersOfFinalAttempt(t *testing.T) {
+	assertion := assert.New(t)
+
+	for _, failures := range []int{1, 10} {
+		deadLetters := &bytes.Buffer{}
+
+		chunks, err := conveyor.GetChunksFromFile("testdata/data.txt", 512, nil)
+		assertion.NoError(err)
+
+		result := conveyor.NewQueue(chunks, 4, newFlakyProcessor(failures, 2), &conveyor.QueueOpts{
+			Logger:     NullLogger(),
+			ErrLogger:  NullLogger(),
+			DeadLetter: conveyor.NewConcurrentWriter(deadLetters, true),
+			RetryPolicy: &conveyor.RetryPolicy{
+				MaxAttempts: 3,
+				Backoff:     time.Millisecond,
+			},
+		}).Work()
+
+		if failures == 1 {
+			assertion.NoError(result.Err)
+			assertion.Empty(result.FailedChunks)
+			assertion.Empty(deadLetters.String())
+		} else {
+			assertion.Equal(1, result.FailedChunks)
+			assertion.Equal(1, strings.Count(deadLetters.String(), errTransient.Error()))
+		}
+	}
+}
+
+func TestRetryPolicyGivesUp(t *testing.T) {
+	assertion := assert.New(t)
+
+	testCases := []struct {
+		name             string
+		policy           *conveyor.RetryPolicy
+		expectedAttempts int
+	}{
+		{
+			name:             "no retry policy",
+			expectedAttempts: 1,
+		},
+		{
+			name:             "max attempts",
+			policy:           &conveyor.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond},
+			expectedAttempts: 3,
+		},
+		{
+			name: "not retryable",
+			policy: &conveyor.RetryPolicy{
+				MaxAttempts: 3,
+				Retryable: func(err error) bool {
+					return !errors.Is(err, errTransient)
+				},
+			},
+			expectedAttempts: 1,
+		},
+	}
+
+	for _, testCase := range testCases {
+		processor := newFlakyProcessor(10, 2)
+
+		chunks, err := conveyor.GetChunksFromFile("testdata/data.txt", 512, nil)
+		assertion.NoError(err)
+
+		result := conveyor.NewQueue(chunks, 4, processor, &conveyor.QueueOpts{
+			Logger:      NullLogger(),
+			ErrLogger:   NullLogger(),
+			RetryPolicy: testCase.policy,
+		}).Work()
+
+		assertion.Equal(1, result.FailedChunks, testCase.name)
+		assertion.Len(result.Results, len(chunks), testCase.name)
+
+		for _, chunkResult := range result.Results {
+			if chunkResult.Chunk.Id == 2 {
+				assertion.ErrorIs(chunkResult.Err, errTransient, testCase.name)
+				assertion.Equal(testCase.expectedAttempts, chunkResult.Attempts, testCase.name)
+			}
+		}
+	}
+}
+
+func TestRetryPolicyCanceledDuringBackoff(t *testing.T) {
+	assertion := assert.New(t)
+
+	chunks, err := conveyor.GetChunksFromFile("testdata/data.txt", 512, nil)
+	assertion.NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	result := conveyor.NewQueue(chunks, 4, newFlakyProcessor(10, 2), &conveyor.QueueOpts{
+		Logger:    NullLogger(),
+		ErrLogger: NullLogger(),
+		RetryPolicy: &conveyor.RetryPolicy{
+			MaxAttempts: 3,
+			Backoff:     time.Hour,
+		},
+	}).WorkContext(ctx)
+
+	assertion.Less(time.Since(start), time.Minute)
+	assertion.ErrorIs(result.Err, context.DeadlineExceeded)
+	assertion.Equal(1, result.FailedChunks)
+	assertion.Len(result.Results, len(chunks))
+}
+
+func TestRetryPolicyDynamicQueue(t *testing.T) {
+	assertion := assert.New(t)
+
+	content, err := ioutil.ReadFile("testdata/data.txt")
+	assertion.NoError(err)
+
+	out := &bytes.Buffer{}
+	queue := conveyor.NewDynamicQueue(2, 512, newFlakyProcessor(1, 1, 3), &conveyor.QueueOpts{
+		Logger:      NullLogger(),
+		ErrLogger:   NullLogger(),
+		RetryPolicy: &conveyor.RetryPolicy{MaxAttempts: 2},
+	})
+
+	queue.Start(context.Background())
+
+	go func() {
+		assertion.NoError(queue.SubmitReader(&conveyor.FileReader{FilePath: "testdata/data.txt"}, conveyor.NewConcurrentWriter(out, true)))
+		queue.Close()
+	}()
+
+	var results []conveyor.ChunkResult
+	for result := range queue.Results() {
+		results = append(results, result)
+	}
+
+	summary := queue.Wait()
+	assertion.NoError(summary.Err)
+	assertion.Empty(summary.FailedChunks)
+	assertion.Len(results, queue.ChunkCount())
+	assertion.Equal(string(content), out.String())
+}
@@ -0,0 +1,170 @@
+package conveyor
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+)
+
+// StreamReader is the ChunkReader for a single chunk of a non seekable stream,
+// e.g. a compressed file. Data holds the content of the stream starting at
+// Offset, up to and including the delimiter that ends the last record of the
+// chunk and the byte that follows it. Offset is in front of the chunk offset
+// by the bytes the Worker looks back to find the first record, it is never
+// inside of a delimiter.
+type StreamReader struct {
+	Name   string
+	Offset int64
+	Data   []byte
+}
+
+// OpenHandle returns a handle that reads Data at the offsets of the stream.
+func (s *StreamReader) OpenHandle() (io.ReadSeekCloser, error) {
+	return &streamHandle{
+		Reader: bytes.NewReader(s.Data),
+		offset: s.Offset,
+	}, nil
+}
+
+// GetHandleID returns the stream name combined with the range of Data,
+// since every StreamReader only holds a part of the stream.
+func (s *StreamReader) GetHandleID() string {
+	return s.Name + "@" + strconv.FormatInt(s.Offset, 10) + "-" + strconv.FormatInt(s.Offset+int64(len(s.Data)), 10)
+}
+
+// streamHandle translates the offsets of the stream to offsets of bytes.Reader.
+type streamHandle struct {
+	*bytes.Reader
+	offset int64
+}
+
+func (s *streamHandle) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekStart {
+		offset -= s.offset
+	}
+
+	position, err := s.Reader.Seek(offset, whence)
+	return position + s.offset, err
+}
+
+// scanStart returns the offset of the start of Data.
+func (s *streamHandle) scanStart() int64 {
+	return s.offset
+}
+
+func (s *streamHandle) Close() error {
+	return nil
+}
+
+// ChunkStream splits the non seekable stream r into chunks of chunkSize and
+// passes them in stream order to submit. The chunk ids start at firstId.
+// delimiter must be the Delimiter of the Queue that processes the chunks.
+// The data of every chunk is held in memory until it is processed, so submit
+// should block while the workers are busy, like Queue.Submit does.
+func ChunkStream(
+	r io.Reader,
+	name string,
+	chunkSize int,
+	firstId int,
+	out ChunkWriter,
+	delimiter Delimiter,
+	submit func(chunks ...Chunk) error,
+) error {
+	delimiter = delimiter.orDefault()
+	sequence := delimiter.Sequence
+
+	// window starts with the prefix bytes in front of the current chunk,
+	// which start outside of a delimiter.
+	var (
+		window    []byte
+		readBuff  = make([]byte, chunkSize)
+		offset    int64
+		id        = firstId
+		eof       bool
+		inQuotes  bool
+		chunkEnd  int
+		prefix    int
+		scanStart int
+		quoted    bool
+	)
+
+	for {
+		chunkEnd, scanStart = -1, -1
+
+		// The byte after the delimiter is read as well, so the worker knows
+		// whether the delimiter terminates the stream.
+		for chunkEnd == -1 || (chunkEnd == len(window) && !eof) {
+			if chunkEnd == -1 && scanStart == -1 && (len(window) >= prefix+chunkSize || eof) {
+				end := prefix + chunkSize
+				if end > len(window) {
+					end = len(window)
+				}
+
+				scanStart, quoted = delimiter.boundaryScan(window[:end], 0, delimiter.quoted(window[:prefix], inQuotes))
+			}
+
+			if chunkEnd == -1 && scanStart != -1 {
+				if i := delimiter.index(window[scanStart:], quoted); i != -1 {
+					chunkEnd = scanStart + i + len(sequence)
+					continue
+				}
+
+				// The delimiter may be split between two reads.
+				if next := len(window) - len(sequence) + 1; next > scanStart {
+					quoted = delimiter.quoted(window[scanStart:next], quoted)
+					scanStart = next
+				}
+			}
+
+			if eof {
+				chunkEnd = len(window)
+				break
+			}
+
+			n, err := r.Read(readBuff)
+			if err != nil && err != io.EOF {
+				return err
+			}
+
+			window = append(window, readBuff[:n]...)
+			eof = err == io.EOF
+		}
+
+		if chunkEnd < len(window) {
+			chunkEnd++
+		}
+
+		if len(window) == prefix {
+			return nil
+		}
+
+		data := make([]byte, chunkEnd)
+		copy(data, window)
+
+		err := submit(Chunk{
+			Id:       id,
+			Offset:   offset,
+			Size:     chunkSize,
+			In:       &StreamReader{Name: name, Offset: offset - int64(prefix), Data: data},
+			Out:      out,
+			InQuotes: inQuotes,
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(window)-prefix <= chunkSize {
+			return nil
+		}
+
+		inQuotes = delimiter.quoted(window[prefix:prefix+chunkSize], inQuotes)
+
+		next := prefix + chunkSize
+		start := delimiter.syncPoint(window[:next], true)
+		prefix = next - start
+
+		window = append(window[:0], window[start:]...)
+		offset += int64(chunkSize)
+		id++
+	}
+}
@@ -0,0 +1,52 @@
+package conveyor_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/fgehrlicher/conveyor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkStreamSplitsAtChunkSize(t *testing.T) {
+	assertion := assert.New(t)
+	stream := "aaaa\nbbbbbbbbbb\ncc\nd"
+
+	var chunks []conveyor.Chunk
+	err := conveyor.ChunkStream(strings.NewReader(stream), "stream", 8, 5, nil, conveyor.LF, func(c ...conveyor.Chunk) error {
+		chunks = append(chunks, c...)
+		return nil
+	})
+	assertion.NoError(err)
+	assertion.Len(chunks, 3)
+
+	// Data starts with the byte in front of the chunk.
+	expectedOffsets := []int64{0, 7, 15}
+	expectedData := []string{
+		"aaaa\nbbbbbbbbbb\nc",
+		"bbbbbbbb\nc",
+		"\ncc\nd",
+	}
+
+	for i, chunk := range chunks {
+		assertion.Equal(5+i, chunk.Id)
+		assertion.Equal(int64(i*8), chunk.Offset)
+
+		reader := chunk.In.(*conveyor.StreamReader)
+		assertion.Equal(expectedOffsets[i], reader.Offset)
+		assertion.Equal(expectedData[i], string(reader.Data))
+
+		handle, err := chunk.In.OpenHandle()
+		assertion.NoError(err)
+
+		position, err := handle.Seek(chunk.Offset+1, io.SeekStart)
+		assertion.NoError(err)
+		assertion.Equal(chunk.Offset+1, position)
+
+		buff := make([]byte, 2)
+		_, err = io.ReadFull(handle, buff)
+		assertion.NoError(err)
+		assertion.Equal(stream[position:position+2], string(buff))
+	}
+}
@@ -6,9 +6,12 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
+	"testing"
 
 	"github.com/fgehrlicher/conveyor"
+	"github.com/stretchr/testify/assert"
 )
 
 var textToRedact = []string{
@@ -90,6 +93,27 @@ func generateTestChunks(count, size int, file string) []conveyor.Chunk {
 	return result
 }
 
+// writeLinesTestFile writes count lines returned by line for the numbers 1 to
+// count, each followed by delimiter, to a temporary file. It returns the path
+// and the lines without delimiters.
+func writeLinesTestFile(t *testing.T, count int, delimiter string, line func(i int) string) (string, []string) {
+	var (
+		path    = filepath.Join(t.TempDir(), "lines.txt")
+		lines   = make([]string, 0, count)
+		content strings.Builder
+	)
+
+	for i := 1; i <= count; i++ {
+		lines = append(lines, line(i))
+
+		content.WriteString(lines[i-1])
+		content.WriteString(delimiter)
+	}
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content.String()), 0644))
+	return path, lines
+}
+
 type InvalidWriter struct {
 	FailAt int
 
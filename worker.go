@@ -2,6 +2,7 @@ package conveyor
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -12,32 +13,46 @@ import (
 const DefaultOverflowScanSize = 1024
 
 var (
+	// ErrNoLinebreakInChunk is not returned anymore. Chunks without a record
+	// start are part of a longer record and succeed without any output.
 	ErrNoLinebreakInChunk = errors.New("no linebreak found in buff")
+
+	// ErrLineTooLong is returned for chunks with a line that exceeds QueueOpts.MaxLineSize.
+	ErrLineTooLong = errors.New("line exceeds the maximum line size")
 )
 
 // All buffs and handles are kept allocated for all iterations of Worker.Process.
 type Worker struct {
-	Id            int
-	TasksChan     chan Chunk
-	resultChan    chan ChunkResult
-	waitGroup     *sync.WaitGroup
-	chunkSize     int64
-	lineProcessor LineProcessor
-
-	handle       io.ReadSeekCloser
-	handleName   string
-	chunk        *Chunk
-	chunkResult  *ChunkResult
-	buff         []byte
-	overflowBuff []byte
-	outBuff      []byte
-
-	buffHead         int
-	overflowBuffHead int
-	outBuffHead      int
-}
-
-// NewWorker returns a new Worker
+	Id             int
+	TasksChan      chan Chunk
+	resultChan     chan ChunkResult
+	waitGroup      *sync.WaitGroup
+	chunkSize      int64
+	lineProcessor  LineProcessor
+	chunkProcessor ChunkProcessor
+	ownProcessor   io.Closer
+	ctx            context.Context
+	opts           *QueueOpts
+	delimiter      Delimiter
+
+	handle           io.ReadSeekCloser
+	handleName       string
+	chunk            *Chunk
+	chunkResult      *ChunkResult
+	buff             []byte
+	overflowScanSize int
+	outBuff          []byte
+	lookbehind       []byte
+	lines            [][]byte
+	deadLetters      []byte
+
+	buffHead    int
+	outBuffHead int
+	currentLine int
+}
+
+// NewWorker returns a new Worker. The optional QueueOpts configure
+// the record delimiter and the line error handling.
 func NewWorker(
 	id int,
 	tasks chan Chunk,
@@ -46,40 +61,104 @@ func NewWorker(
 	chunkSize int64,
 	overflowScanSize int,
 	waitGroup *sync.WaitGroup,
+	opts ...*QueueOpts,
 ) *Worker {
+	opt := &QueueOpts{}
+	if len(opts) > 0 && opts[0] != nil {
+		opt = opts[0]
+	}
+
+	var ownProcessor io.Closer
+	if factory, ok := lineProcessor.(LineProcessorFactory); ok {
+		lineProcessor = factory.NewLineProcessor(id)
+		ownProcessor, _ = lineProcessor.(io.Closer)
+	}
+
+	chunkProcessor, _ := lineProcessor.(ChunkProcessor)
+
 	return &Worker{
-		Id:            id,
-		TasksChan:     tasks,
-		resultChan:    result,
-		waitGroup:     waitGroup,
-		chunkSize:     chunkSize,
-		lineProcessor: lineProcessor,
-		buff:          make([]byte, chunkSize),
-		outBuff:       make([]byte, chunkSize),
-		overflowBuff:  make([]byte, overflowScanSize),
-		buffHead:      0,
-		outBuffHead:   0,
+		Id:               id,
+		TasksChan:        tasks,
+		resultChan:       result,
+		waitGroup:        waitGroup,
+		chunkSize:        chunkSize,
+		lineProcessor:    lineProcessor,
+		chunkProcessor:   chunkProcessor,
+		ownProcessor:     ownProcessor,
+		ctx:              context.Background(),
+		opts:             opt,
+		delimiter:        opt.Delimiter.orDefault(),
+		buff:             make([]byte, chunkSize, chunkSize+int64(overflowScanSize)),
+		overflowScanSize: overflowScanSize,
+		outBuff:          make([]byte, chunkSize),
+		lookbehind:       make([]byte, 0, len(opt.Delimiter.orDefault().Sequence)),
+		buffHead:         0,
+		outBuffHead:      0,
 	}
 }
 
 // Work processes chunks from Worker.TasksChan until queue is empty
 func (w *Worker) Work() {
+	w.WorkContext(context.Background())
+}
+
+// WorkContext processes chunks from Worker.TasksChan until queue is empty
+// or ctx is done. Once ctx is done no new chunks are pulled from Worker.TasksChan
+// and the chunk currently in progress is aborted before its next line.
+func (w *Worker) WorkContext(ctx context.Context) {
 	defer w.waitGroup.Done()
+	defer w.closeLineProcessor()
+	defer w.closeFileHandle()
+
+	w.ctx = ctx
+
+	for ctx.Err() == nil {
+		var (
+			chunk Chunk
+			ok    bool
+		)
+
+		select {
+		case chunk, ok = <-w.TasksChan:
+		case <-ctx.Done():
+		}
+
+		if !ok {
+			return
+		}
 
-	for chunk := range w.TasksChan {
 		w.chunk = &chunk
-		w.chunkResult = &ChunkResult{Chunk: chunk}
+		w.chunkResult = &ChunkResult{Chunk: chunk, Attempts: chunk.attempts + 1}
+
+		err := ctx.Err()
+		if err == nil {
+			err = w.Process()
+		}
+
+		if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+			err = notProcessedErr(ctxErr)
+		}
 
-		w.chunkResult.Err = w.Process()
+		w.chunkResult.Err = err
 
 		w.resultChan <- *w.chunkResult
 	}
 }
 
-func (w *Worker) Process() error {
+func (w *Worker) Process() (err error) {
 	defer w.resetBuffers()
 
-	err := w.prepareFileHandles()
+	defer func() {
+		if deadLetterErr := w.writeDeadLetters(err); deadLetterErr != nil && err == nil {
+			err = fmt.Errorf("error while writing dead letters: %w", deadLetterErr)
+		}
+	}()
+
+	if !w.opts.Repanic {
+		defer w.recoverPanic(&err)
+	}
+
+	err = w.prepareFileHandles()
 	if err != nil {
 		return fmt.Errorf("error while preparing file handles: %w", err)
 	}
@@ -89,14 +168,23 @@ func (w *Worker) Process() error {
 		return fmt.Errorf("error while reading Chunk in buff: %w", err)
 	}
 
-	err = w.prepareBuff()
+	ownsRecords, err := w.prepareBuff()
 	if err != nil {
 		return fmt.Errorf("error while preparing buff: %w", err)
 	}
 
-	err = w.processBuff()
+	err = w.processRecords(ownsRecords)
+
+	if err == nil && w.chunk.ExpectedLines > 0 && w.chunkResult.Lines != w.chunk.ExpectedLines {
+		err = fmt.Errorf("%w: expected %d lines, got %d", ErrUnexpectedLineCount, w.chunk.ExpectedLines, w.chunkResult.Lines)
+	}
+
+	if endErr := w.endChunk(err); endErr != nil && err == nil {
+		err = fmt.Errorf("error in chunk end hook: %w", endErr)
+	}
+
 	if err != nil {
-		return fmt.Errorf("error while processing buff: %w", err)
+		return err
 	}
 
 	err = w.writeOutBuff()
@@ -107,57 +195,262 @@ func (w *Worker) Process() error {
 	return nil
 }
 
-func (w *Worker) prepareBuff() error {
-	if w.chunk.Offset != 0 {
-		i := bytes.IndexByte(w.buff, '\n')
-		if i == -1 {
-			return ErrNoLinebreakInChunk
+// startChunk calls the ChunkStartHook of the LineProcessor and the ChunkWriter.
+func (w *Worker) startChunk() error {
+	for _, v := range []interface{}{w.lineProcessor, w.chunk.Out} {
+		if hook, ok := v.(ChunkStartHook); ok {
+			if err := hook.OnChunkStart(*w.chunk); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// endChunk calls the ChunkEndHook of the LineProcessor and the ChunkWriter
+// with the current ChunkResult and err as its error.
+func (w *Worker) endChunk(err error) error {
+	result := *w.chunkResult
+	result.Err = err
+
+	for _, v := range []interface{}{w.lineProcessor, w.chunk.Out} {
+		if hook, ok := v.(ChunkEndHook); ok {
+			if hookErr := hook.OnChunkEnd(result); hookErr != nil {
+				return hookErr
+			}
 		}
+	}
+
+	return nil
+}
+
+// processRecords calls the chunk start hooks and processes the records of the
+// chunk. A panic is converted into a PanicError here, so the chunk end hooks
+// are called for every chunk whose start hooks were called.
+func (w *Worker) processRecords(ownsRecords bool) (err error) {
+	if !w.opts.Repanic {
+		defer w.recoverPanic(&err)
+	}
 
-		w.buffHead += i + 1
-		w.chunkResult.RealOffset = w.chunk.Offset + int64(i)
+	if err = w.startChunk(); err != nil {
+		return fmt.Errorf("error in chunk start hook: %w", err)
+	}
+
+	switch {
+	case !ownsRecords:
+		// The chunk is part of a record that started in a previous chunk,
+		// so there is nothing to process.
+	case w.chunkProcessor != nil:
+		if err = w.processChunk(); err != nil {
+			return fmt.Errorf("error while processing chunk: %w", err)
+		}
+	default:
+		if err = w.processBuff(); err != nil {
+			return fmt.Errorf("error while processing buff: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// prepareBuff skips the record that belongs to the previous chunk and reads
+// the overflow of the chunk. Every record belongs to the chunk that contains
+// its first byte. prepareBuff reports false if no record starts inside the
+// chunk, because the whole chunk is part of a record that is longer than the
+// chunk size. The overflow is not read in that case. Aligned chunks start
+// with their first record and end with the delimiter of their last record,
+// so no overflow is read for them either.
+func (w *Worker) prepareBuff() (bool, error) {
+	if w.chunk.Offset != 0 && !w.chunk.Aligned {
+		start, delimiterStart := firstRecordStart(w.delimiter, w.lookbehind, w.buff, w.chunk.InQuotes)
+		if start == -1 || start >= w.chunk.Size {
+			w.chunkResult.RealSize = 0
+			return false, nil
+		}
+
+		w.buffHead = start
+		w.chunkResult.RealOffset = w.chunk.Offset + int64(delimiterStart)
 	}
 
 	if !w.chunkResult.EOF {
 		err := w.readOverflowInBuff()
 		if err != nil {
-			return err
+			return false, err
 		}
 
-		w.chunkResult.RealSize += len(w.overflowBuff)
+		w.chunkResult.RealSize = len(w.buff)
 	}
 
-	return nil
+	return true, nil
+}
+
+// firstRecordStart returns the index of the first record in buff, which
+// starts after the first delimiter that ends at or after the start of buff,
+// and the index of that delimiter. The delimiter may start in lookbehind, the
+// bytes in front of buff, which must start outside of a delimiter, see
+// readLookbehind. inQuotes is the quote state at the start of buff.
+// It returns -1 if there is no such delimiter.
+func firstRecordStart(delimiter Delimiter, lookbehind, buff []byte, inQuotes bool) (int, int) {
+	sequence := delimiter.Sequence
+
+	if len(lookbehind) > 0 {
+		rest := len(sequence) - 1
+		if rest > len(buff) {
+			rest = len(buff)
+		}
+
+		window := append(lookbehind[:len(lookbehind):len(lookbehind)], buff[:rest]...)
+		quoted := delimiter.quoted(lookbehind, inQuotes)
+
+		for position := 0; ; {
+			i := delimiter.index(window[position:], quoted)
+			if i == -1 {
+				break
+			}
+
+			if end := position + i + len(sequence); end >= len(lookbehind) {
+				return end - len(lookbehind), position + i - len(lookbehind)
+			}
+
+			position += i + len(sequence)
+			quoted = false
+		}
+	}
+
+	i := delimiter.index(buff, inQuotes)
+	if i == -1 {
+		return -1, -1
+	}
+
+	return i + len(sequence), i
 }
 
-// prepareFileHandles creates the main read handle and sets
-// the read offset.
+// readLookbehind reads the bytes in front of offset that are needed to find
+// the first record at offset into buff and leaves handle at offset. They
+// start at a position that is outside of a delimiter, which may be further
+// in front of offset than the Sequence is long if Sequences can overlap.
+func readLookbehind(handle io.ReadSeeker, delimiter Delimiter, offset int64, buff []byte) ([]byte, error) {
+	var first int64
+	if partial, ok := handle.(partialHandle); ok {
+		first = partial.scanStart()
+	}
+
+	size := int64(len(delimiter.Sequence))
+	if delimiter.overlaps() {
+		size *= 2
+	}
+
+	for {
+		if size > offset-first {
+			size = offset - first
+		}
+
+		if _, err := handle.Seek(offset-size, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		if int64(cap(buff)) < size {
+			buff = make([]byte, size)
+		}
+
+		buff = buff[:size]
+		if _, err := io.ReadFull(handle, buff); err != nil {
+			return nil, err
+		}
+
+		if start := delimiter.syncPoint(buff, offset-size == first); start != -1 {
+			return buff[:copy(buff, buff[start:])], nil
+		}
+
+		size *= 2
+	}
+}
+
+// partialHandle is implemented by handles that only hold the input from
+// scanStart on, which is outside of a delimiter, see StreamReader.
+type partialHandle interface {
+	scanStart() int64
+}
+
+// prepareFileHandles creates the main read handle and sets the read offset
+// to the chunk offset.
 func (w *Worker) prepareFileHandles() (err error) {
 	if w.handle == nil || w.chunk.In.GetHandleID() != w.handleName {
+		w.closeFileHandle()
+
 		w.handle, err = w.chunk.In.OpenHandle()
 		if err != nil {
+			w.handle = nil
 			return
 		}
+
+		w.handleName = w.chunk.In.GetHandleID()
 	}
 
 	_, err = w.handle.Seek(w.chunk.Offset, io.SeekStart)
 	return
 }
 
-// resetBuffers extend the size of all buffers to their cap and
-// resets all buffer heads.
+// closeFileHandle closes the cached read handle.
+func (w *Worker) closeFileHandle() {
+	if w.handle != nil {
+		w.handle.Close()
+		w.handle = nil
+		w.handleName = ""
+	}
+}
+
+// closeLineProcessor closes the LineProcessor created for the Worker
+// by a LineProcessorFactory.
+func (w *Worker) closeLineProcessor() {
+	if w.ownProcessor == nil {
+		return
+	}
+
+	if err := w.ownProcessor.Close(); err != nil && w.opts.ErrLogger != nil {
+		w.opts.ErrLogger.Printf("worker %d: error while closing line processor: %s", w.Id, err)
+	}
+
+	w.ownProcessor = nil
+}
+
+// resetBuffers resets the size of Worker.buff to the chunk size, extends
+// all other buffers to their cap and resets all buffer heads.
 func (w *Worker) resetBuffers() {
-	w.buff = w.buff[:cap(w.buff)]
-	w.overflowBuff = w.overflowBuff[:cap(w.overflowBuff)]
+	w.buff = w.buff[:w.chunkSize]
 	w.outBuff = w.outBuff[:cap(w.outBuff)]
+	w.deadLetters = w.deadLetters[:0]
+	w.lines = w.lines[:0]
 	w.buffHead = 0
 	w.outBuffHead = 0
-	w.overflowBuffHead = 0
 }
 
 // readChunkInBuff reads up to len(worker.buff) bytes from the file.
+// Short reads are continued, so handles that return less than requested
+// (e.g. decompressing readers) are supported.
 func (w *Worker) readChunkInBuff() (err error) {
-	w.chunkResult.RealSize, err = w.handle.Read(w.buff)
+	w.lookbehind = w.lookbehind[:0]
+	if w.chunk.Offset != 0 && !w.chunk.Aligned {
+		// The bytes in front of the chunk may contain the delimiter
+		// in front of its first record.
+		if w.lookbehind, err = readLookbehind(w.handle, w.delimiter, w.chunk.Offset, w.lookbehind); err != nil {
+			return
+		}
+	}
+
+	if w.chunk.Size != len(w.buff) {
+		if cap(w.buff) < w.chunk.Size {
+			w.buff = make([]byte, w.chunk.Size, w.chunk.Size+w.overflowScanSize)
+		}
+
+		w.buff = w.buff[:w.chunk.Size]
+	}
+
+	w.chunkResult.RealSize, err = io.ReadFull(w.handle, w.buff)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
 
 	if w.chunkResult.RealSize != w.chunk.Size {
 		w.buff = w.buff[:w.chunkResult.RealSize]
@@ -167,45 +460,106 @@ func (w *Worker) readChunkInBuff() (err error) {
 	return
 }
 
-// readOverflowInBuff reads chunks of size DefaultOverflowScanSize until the next
-// linebreak has been found.
+// readOverflowInBuff appends the bytes after the chunk to Worker.buff in steps
+// of the overflow scan size until the first delimiter that ends at or after
+// the end of the chunk or the end of the file has been found. The delimiter
+// itself is not part of Worker.buff. Since the overflow is part of a single
+// line, it fails with ErrLineTooLong once it exceeds QueueOpts.MaxLineSize.
 func (w *Worker) readOverflowInBuff() error {
-	buffSize := len(w.overflowBuff)
+	var (
+		sequence = w.delimiter.Sequence
+		chunkEnd = w.chunkResult.RealSize
+		readErr  error
+	)
+
+	// The last record of the chunk ends with the first delimiter that
+	// ends at or after the chunk end, since the next record starts there.
+	scanStart, quoted := w.delimiter.boundaryScan(
+		w.buff[:chunkEnd],
+		w.buffHead,
+		w.delimiter.quoted(w.buff[:w.buffHead], w.chunk.InQuotes),
+	)
 
 	for {
-		scanBuff := w.overflowBuff[w.overflowBuffHead:]
+		if i := w.delimiter.index(w.buff[scanStart:], quoted); i != -1 {
+			end := scanStart + i + len(sequence)
+			if end == len(w.buff) && w.handleAtEOF() {
+				// The delimiter terminates the file, so it is kept like
+				// the delimiter of every other last record of a file.
+				w.chunkResult.EOF = true
+				return nil
+			}
 
-		if _, err := w.handle.Read(scanBuff); err != nil {
+			w.buff = w.buff[:scanStart+i]
+			return nil
+		}
+
+		if readErr == io.EOF {
+			w.chunkResult.EOF = true
+			return nil
+		}
+
+		if err := w.checkLineSize(len(w.buff) - chunkEnd); err != nil {
 			return err
 		}
 
-		i := bytes.IndexByte(scanBuff, '\n')
-		if i != -1 {
-			w.overflowBuffHead += i
-			w.overflowBuff = w.overflowBuff[:w.overflowBuffHead]
-			break
+		// The delimiter may be split between two reads.
+		if next := len(w.buff) - len(sequence) + 1; next > scanStart {
+			quoted = w.delimiter.quoted(w.buff[scanStart:next], quoted)
+			scanStart = next
+		}
+
+		head := len(w.buff)
+		if cap(w.buff)-head < w.overflowScanSize {
+			newBuff := make([]byte, head, 2*cap(w.buff)+w.overflowScanSize)
+			copy(newBuff, w.buff)
+			w.buff = newBuff
 		}
 
-		w.overflowBuffHead = buffSize
-		buffSize += buffSize
-		newBuff := make([]byte, buffSize)
+		var n int
+		n, readErr = w.handle.Read(w.buff[head : head+w.overflowScanSize])
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+
+		w.buff = w.buff[:head+n]
+	}
+}
 
-		copy(newBuff, w.overflowBuff)
-		w.overflowBuff = newBuff
+// checkLineSize returns ErrLineTooLong if size exceeds QueueOpts.MaxLineSize.
+func (w *Worker) checkLineSize(size int) error {
+	if w.opts.MaxLineSize > 0 && size > w.opts.MaxLineSize {
+		return fmt.Errorf("%w: more than %d bytes", ErrLineTooLong, w.opts.MaxLineSize)
 	}
 
 	return nil
 }
 
-// processBuff converts all the json content in Worker.buff and
-// Worker.overflowBuff to csv and safes it into Worker.outBuff
+// handleAtEOF reports whether all bytes of the handle have been read.
+func (w *Worker) handleAtEOF() bool {
+	var next [1]byte
+
+	_, err := io.ReadFull(w.handle, next[:])
+	return err == io.EOF
+}
+
+// processBuff passes every record in Worker.buff to the LineProcessor
+// and saves the output into Worker.outBuff
 func (w *Worker) processBuff() error {
-	var relativeIndex int
+	sequence := w.delimiter.Sequence
 
 	for {
-		relativeIndex = bytes.IndexByte(w.buff[w.buffHead:], '\n')
+		if err := w.ctx.Err(); err != nil {
+			return err
+		}
+
+		relativeIndex := w.delimiter.index(w.buff[w.buffHead:], false)
 
 		if relativeIndex == -1 {
+			if w.chunkResult.EOF && w.buffHead == len(w.buff) {
+				break
+			}
+
 			if err := w.processOverflowLine(); err != nil {
 				return fmt.Errorf("error while processing last Line of Chunk: %w", err)
 			}
@@ -213,28 +567,80 @@ func (w *Worker) processBuff() error {
 			break
 		}
 
-		if err := w.processLine(relativeIndex + 1); err != nil {
+		if err := w.processLine(relativeIndex + len(sequence)); err != nil {
 			return fmt.Errorf("error while processing Line of Chunk: %w", err)
 		}
+	}
+
+	return nil
+}
+
+// processChunk splits Worker.buff into lines like processBuff and passes
+// all of them to the ChunkProcessor at once.
+func (w *Worker) processChunk() error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+
+	sequence := w.delimiter.Sequence
+
+	for {
+		relativeIndex := w.delimiter.index(w.buff[w.buffHead:], false)
+
+		if relativeIndex == -1 {
+			if w.chunkResult.EOF && w.buffHead == len(w.buff) {
+				break
+			}
+
+			line := w.buff[w.buffHead:]
+			if err := w.checkLineSize(len(line)); err != nil {
+				return err
+			}
+
+			if !w.chunkResult.EOF {
+				line = w.delimiter.stripCR(line, len(line))
+			}
 
-		if w.buffHead == w.chunkResult.RealSize {
+			w.lines = append(w.lines, line)
+			w.buffHead = len(w.buff)
 			break
 		}
+
+		if err := w.checkLineSize(relativeIndex); err != nil {
+			return err
+		}
+
+		end := relativeIndex + len(sequence)
+		line := w.buff[w.buffHead : w.buffHead+end]
+
+		w.lines = append(w.lines, w.delimiter.stripCR(line, relativeIndex))
+		w.buffHead += end
+	}
+
+	out, err := w.chunkProcessor.ProcessChunk(w.lines, ChunkMetadata{
+		WorkerId: w.Id,
+		Chunk:    w.chunk,
+		Context:  w.ctx,
+	})
+	if err != nil {
+		return err
 	}
 
+	w.addToOutBuff(out)
+	w.chunkResult.Lines = len(w.lines)
+
 	return nil
 }
 
 func (w *Worker) processLine(relativeIndex int) error {
+	if err := w.checkLineSize(relativeIndex - len(w.delimiter.Sequence)); err != nil {
+		return err
+	}
+
 	line := w.buff[w.buffHead : w.buffHead+relativeIndex]
-	convertedLine, err := w.lineProcessor.Process(
-		line, LineMetadata{
-			WorkerId: w.Id,
-			Line:     w.chunkResult.Lines + 1,
-			Chunk:    w.chunk,
-		},
-	)
+	line = w.delimiter.stripCR(line, len(line)-len(w.delimiter.Sequence))
 
+	convertedLine, err := w.processLineContent(line)
 	if err != nil {
 		return err
 	}
@@ -246,30 +652,104 @@ func (w *Worker) processLine(relativeIndex int) error {
 	return nil
 }
 
+// processOverflowLine processes the last record of the chunk, which is
+// not terminated by the delimiter in Worker.buff.
 func (w *Worker) processOverflowLine() error {
-	remainingBuff := w.buff[w.buffHead:]
-	line := make([]byte, len(remainingBuff)+w.overflowBuffHead)
-	copy(line[:len(remainingBuff)], remainingBuff)
-	copy(line[len(remainingBuff):], w.overflowBuff)
-
-	convertedLine, err := w.lineProcessor.Process(
-		line,
-		LineMetadata{
-			WorkerId: w.Id,
-			Line:     w.chunkResult.Lines + 1,
-			Chunk:    w.chunk,
-		},
-	)
+	if err := w.checkLineSize(len(w.buff) - w.buffHead); err != nil {
+		return err
+	}
+
+	line := w.buff[w.buffHead:]
+	if !w.chunkResult.EOF {
+		line = w.delimiter.stripCR(line, len(line))
+	}
+
+	convertedLine, err := w.processLineContent(line)
 	if err != nil {
 		return err
 	}
 
 	w.addToOutBuff(convertedLine)
 
+	// The ChunkWriter separates the outputs of the chunks, so the delimiter of
+	// the previous line must not end the output if the last line was dropped.
+	if len(convertedLine) == 0 && len(line) > 0 && !w.chunkResult.EOF {
+		if bytes.HasSuffix(w.outBuff[:w.outBuffHead], w.delimiter.Sequence) {
+			w.outBuffHead -= len(w.delimiter.Sequence)
+		}
+	}
+
+	w.buffHead = len(w.buff)
 	w.chunkResult.Lines++
 	return nil
 }
 
+// processLineContent passes line to the LineProcessor and applies the
+// LineErrorPolicy if it fails. Errors caused by a done context are never
+// skipped or replaced.
+func (w *Worker) processLineContent(line []byte) ([]byte, error) {
+	metadata := w.lineMetadata()
+
+	w.currentLine = metadata.Line
+	convertedLine, err := w.lineProcessor.Process(line, metadata)
+	w.currentLine = 0
+
+	if err == nil {
+		return convertedLine, nil
+	}
+
+	if ctxErr := w.ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+		return nil, err
+	}
+
+	lineErr := &LineError{
+		ChunkId:      w.chunk.Id,
+		Line:         metadata.Line,
+		AbsoluteLine: metadata.AbsoluteLine,
+		Offset:       metadata.Offset,
+		Err:          err,
+	}
+
+	w.addToDeadLetters(lineErr, bytes.TrimSuffix(line, w.delimiter.Sequence))
+
+	switch w.opts.LineErrorPolicy {
+	case SkipLine:
+		convertedLine = nil
+	case ReplaceLine:
+		convertedLine = nil
+		if w.opts.LineErrorReplacer != nil {
+			convertedLine, err = w.opts.LineErrorReplacer(line, metadata, err)
+			if err != nil {
+				lineErr.Err = fmt.Errorf("error while replacing line: %w", err)
+				return nil, lineErr
+			}
+		}
+	default:
+		return nil, lineErr
+	}
+
+	w.chunkResult.LineErrors = append(w.chunkResult.LineErrors, lineErr)
+	return convertedLine, nil
+}
+
+// lineMetadata returns the LineMetadata for the line that is processed next.
+func (w *Worker) lineMetadata() LineMetadata {
+	metadata := LineMetadata{
+		WorkerId:  w.Id,
+		Line:      w.chunkResult.Lines + 1,
+		Chunk:     w.chunk,
+		Context:   w.ctx,
+		Offset:    w.chunk.Offset + int64(w.buffHead),
+		Delimiter: w.delimiter,
+	}
+
+	if w.chunk.StartLine > 0 {
+		metadata.AbsoluteLine = w.chunk.StartLine + int64(w.chunkResult.Lines)
+	}
+
+	return metadata
+}
+
 func (w *Worker) addToOutBuff(b []byte) {
 	if len(b) == 0 {
 		return
@@ -285,11 +765,75 @@ func (w *Worker) addToOutBuff(b []byte) {
 	w.outBuffHead += len(b)
 }
 
+// writeOutBuff writes the output of the chunk. Out.Write is called even if
+// there is no output, so that a ConcurrentWriter which keeps the order does
+// not wait for the chunk.
 func (w *Worker) writeOutBuff() (err error) {
-	if w.outBuffHead > 0 && w.chunk.Out != nil {
+	if w.chunk.Out != nil {
 		outBuff := w.outBuff[:w.outBuffHead]
+		w.chunk.eof = w.chunkResult.EOF
 		err = w.chunk.Out.Write(w.chunk, outBuff)
+		w.chunkResult.OutSize = w.outBuffHead
 	}
 
 	return
 }
+
+// deadLetterWriter returns the dead letter ChunkWriter of the current chunk.
+func (w *Worker) deadLetterWriter() ChunkWriter {
+	return deadLetterWriter(w.chunk, w.opts)
+}
+
+// deadLetterWriter returns the dead letter ChunkWriter of chunk.
+func deadLetterWriter(chunk *Chunk, opts *QueueOpts) ChunkWriter {
+	if chunk.DeadLetter != nil {
+		return chunk.DeadLetter
+	}
+
+	return opts.DeadLetter
+}
+
+func (w *Worker) addToDeadLetters(lineErr *LineError, line []byte) {
+	if w.deadLetterWriter() == nil {
+		return
+	}
+
+	formatter := w.opts.DeadLetterFormatter
+	if formatter == nil {
+		formatter = DefaultDeadLetterFormatter
+	}
+
+	if len(w.deadLetters) > 0 {
+		w.deadLetters = append(w.deadLetters, '\n')
+	}
+
+	w.deadLetters = append(w.deadLetters, formatter(lineErr, line)...)
+}
+
+// writeDeadLetters writes the dead letters of the current chunk. It is called
+// for every chunk, even if it has no dead letters, so that a ConcurrentWriter
+// which keeps the order does not wait for it. Chunks that were aborted because
+// the context is done, see err, are skipped. The dead letters of a failed attempt that is retried by the
+// RetryPolicy are held in the ChunkResult instead, the Queue writes them if
+// the attempt turns out to be the final one.
+func (w *Worker) writeDeadLetters(err error) error {
+	out := w.deadLetterWriter()
+	if out == nil {
+		return nil
+	}
+
+	if ctxErr := w.ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+		return nil
+	}
+
+	result := *w.chunkResult
+	result.Err = err
+
+	if w.opts.RetryPolicy.retries(result) {
+		w.chunkResult.deadLetters = append([]byte(nil), w.deadLetters...)
+		w.chunkResult.holdsDeadLetters = true
+		return nil
+	}
+
+	return out.Write(w.chunk, w.deadLetters)
+}
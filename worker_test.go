@@ -1,7 +1,9 @@
 package conveyor_test
 
 import (
+	"bytes"
 	"errors"
+	"strings"
 	"sync"
 	"testing"
 
@@ -187,3 +189,100 @@ func TestWorkerFailsOverflowBuff(t *testing.T) {
 		assertion.ErrorIs(result.Err, ErrInvalidRead)
 	}
 }
+
+func TestWorkerAppliesLineErrorPolicy(t *testing.T) {
+	assertion := assert.New(t)
+	chunkSize := 16384
+	expectedErr := errors.New("test error")
+	failingLines := map[int]bool{1: true, 50: true, 100: true}
+
+	tt := []struct {
+		Policy         conveyor.LineErrorPolicy
+		ExpectedOutput string
+	}{
+		{Policy: conveyor.SkipLine, ExpectedOutput: ""},
+		{Policy: conveyor.ReplaceLine, ExpectedOutput: "replaced\n"},
+	}
+
+	for _, test := range tt {
+		buff := &bytes.Buffer{}
+		results := make(chan conveyor.ChunkResult, 1)
+
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		conveyor.NewWorker(
+			1,
+			GetSingleChunkChan("testdata/data.txt", chunkSize, conveyor.NewConcurrentWriter(buff, true)),
+			results,
+			conveyor.LineProcessorFunc(func(i []byte, metadata conveyor.LineMetadata) ([]byte, error) {
+				if failingLines[metadata.Line] {
+					return nil, expectedErr
+				}
+
+				return nil, nil
+			}),
+			int64(chunkSize),
+			1024,
+			wg,
+			&conveyor.QueueOpts{
+				LineErrorPolicy: test.Policy,
+				LineErrorReplacer: func(line []byte, metadata conveyor.LineMetadata, err error) ([]byte, error) {
+					return []byte("replaced\n"), nil
+				},
+			},
+		).Work()
+
+		close(results)
+		result := <-results
+
+		assertion.True(result.Ok())
+		assertion.Equal(100, result.Lines)
+		assertion.Len(result.LineErrors, len(failingLines))
+		assertion.Equal(strings.Repeat(test.ExpectedOutput, len(failingLines)), buff.String())
+
+		for _, lineErr := range result.LineErrors {
+			assertion.True(failingLines[lineErr.Line])
+			assertion.Equal(1, lineErr.ChunkId)
+			assertion.ErrorIs(lineErr, expectedErr)
+		}
+
+		assertion.Equal(int64(0), result.LineErrors[0].Offset)
+	}
+}
+
+func TestWorkerReturnsLineErrorForFailChunkPolicy(t *testing.T) {
+	assertion := assert.New(t)
+	chunkSize := 16384
+	expectedErr := errors.New("test error")
+
+	results := make(chan conveyor.ChunkResult, 1)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	conveyor.NewWorker(
+		1,
+		GetSingleChunkChan("testdata/5_lines.txt", chunkSize, nil),
+		results,
+		conveyor.LineProcessorFunc(func(i []byte, metadata conveyor.LineMetadata) ([]byte, error) {
+			if metadata.Line == 2 {
+				return nil, expectedErr
+			}
+
+			return i, nil
+		}),
+		int64(chunkSize),
+		1024,
+		wg,
+	).Work()
+
+	close(results)
+	result := <-results
+
+	var lineErr *conveyor.LineError
+	assertion.ErrorAs(result.Err, &lineErr)
+	assertion.ErrorIs(result.Err, expectedErr)
+	assertion.Equal(2, lineErr.Line)
+	assertion.Equal(int64(75), lineErr.Offset)
+}
@@ -1,10 +1,17 @@
 package conveyor
 
 import (
+	"bytes"
+	"errors"
 	"io"
 	"sync"
 )
 
+// ErrResumeNotSupported is returned by ConcurrentWriter.Resume if the writer
+// does not keep the order or the underlying io.Writer can not be truncated.
+// A Queue with a Checkpoint fails with it for other ordered ChunkWriters.
+var ErrResumeNotSupported = errors.New("resume not supported by writer")
+
 // The ConcurrentWriter type is a thread-safe wrapper for
 // io.Writer that is able to keep the order of lines across all chunks.
 type ConcurrentWriter struct {
@@ -12,48 +19,161 @@ type ConcurrentWriter struct {
 
 	keepOrder        bool
 	lastChunkWritten int
-	cache            map[int][]byte
+	cache            map[int]cachedBuff
 	firstWrite       bool
+	endsInSeparator  bool
+	separator        []byte
 
 	sync.Mutex
 }
 
-// NewConcurrentWriter returns a new ConcurrentWriter
-func NewConcurrentWriter(writer io.Writer, keepOrder bool) *ConcurrentWriter {
+// NewConcurrentWriter returns a new ConcurrentWriter. The output of
+// two chunks is separated by the Sequence of the optional Delimiter,
+// which defaults to DefaultDelimiter. The output of a chunk at the end
+// of its input keeps the delimiter of its last line, so it is not
+// separated again from the output of the next chunk.
+func NewConcurrentWriter(writer io.Writer, keepOrder bool, delimiter ...Delimiter) *ConcurrentWriter {
 	return &ConcurrentWriter{
 		keepOrder:  keepOrder,
 		handle:     writer,
-		cache:      make(map[int][]byte),
+		cache:      make(map[int]cachedBuff),
 		firstWrite: true,
+		separator:  optionalDelimiter(delimiter).Sequence,
 	}
 }
 
 func (c *ConcurrentWriter) Write(chunk *Chunk, buff []byte) error {
+	return c.write(chunk, buff, chunk.eof && bytes.HasSuffix(buff, c.separator))
+}
+
+// write writes buff for chunk. endsInSeparator reports whether buff is
+// the output of a chunk at the end of its input that ends with the
+// delimiter, so no separator is written after it.
+func (c *ConcurrentWriter) write(chunk *Chunk, buff []byte, endsInSeparator bool) error {
 	c.Lock()
 	defer c.Unlock()
 
 	if !c.keepOrder {
-		return c.writeBuff(buff)
+		return c.writeBuff(buff, endsInSeparator)
 	}
 
-	c.addToCache(chunk.Id, buff)
+	c.addToCache(chunk.Id, buff, endsInSeparator)
 	return c.writeCache()
 }
 
-func (c *ConcurrentWriter) addToCache(id int, buff []byte) {
-	c.cache[id] = make([]byte, len(buff))
-	copy(c.cache[id], buff)
+// KeepsOrder reports whether the chunks are written in order of their ids.
+func (c *ConcurrentWriter) KeepsOrder() bool {
+	return c.keepOrder
+}
+
+// Resume prepares the ConcurrentWriter to continue an interrupted run that
+// recorded its progress in checkpoint. The underlying io.Writer must be the
+// output of the interrupted run opened for reading and writing without
+// truncation (e.g. an *os.File opened with os.O_RDWR). It is truncated to
+// the output of all chunks that are marked as completed in checkpoint, so
+// the resumed output is identical to the output of an uninterrupted run.
+func (c *ConcurrentWriter) Resume(checkpoint *Checkpoint) error {
+	c.Lock()
+	defer c.Unlock()
+
+	handle, ok := c.handle.(interface {
+		io.Seeker
+		io.ReaderAt
+		Truncate(size int64) error
+	})
+	if !c.keepOrder || !ok {
+		return ErrResumeNotSupported
+	}
+
+	var (
+		lastChunk       = checkpoint.lastContiguous()
+		size            int64
+		written         bool
+		endsInSeparator bool
+		tail            = make([]byte, len(c.separator))
+	)
+
+	for id := 1; id <= lastChunk; id++ {
+		entry, _ := checkpoint.Entry(id)
+		if entry.OutSize == 0 {
+			continue
+		}
+
+		if written && !endsInSeparator {
+			size += int64(len(c.separator))
+		}
+
+		size += int64(entry.OutSize)
+		written = true
+
+		endsInSeparator = false
+		if entry.EOF && entry.OutSize >= len(tail) {
+			if _, err := handle.ReadAt(tail, size-int64(len(tail))); err != nil {
+				return err
+			}
+
+			endsInSeparator = bytes.Equal(tail, c.separator)
+		}
+	}
+
+	if err := handle.Truncate(size); err != nil {
+		return err
+	}
+
+	if _, err := handle.Seek(size, io.SeekStart); err != nil {
+		return err
+	}
+
+	c.lastChunkWritten = lastChunk
+	c.firstWrite = !written
+	c.endsInSeparator = endsInSeparator
+
+	return nil
+}
+
+// cachedBuff is the output of a chunk that waits for the chunks before it.
+type cachedBuff struct {
+	buff            []byte
+	endsInSeparator bool
+}
+
+func (c *ConcurrentWriter) lastChunk() int {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.lastChunkWritten
+}
+
+// continueAfter continues writing after the chunk with the given id. A
+// seekable output is continued at its end.
+func (c *ConcurrentWriter) continueAfter(chunkId int) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.lastChunkWritten = chunkId
+
+	if seeker, ok := c.handle.(io.Seeker); ok {
+		if size, err := seeker.Seek(0, io.SeekEnd); err == nil && size > 0 {
+			c.firstWrite = false
+		}
+	}
+}
+
+func (c *ConcurrentWriter) addToCache(id int, buff []byte, endsInSeparator bool) {
+	cached := cachedBuff{buff: make([]byte, len(buff)), endsInSeparator: endsInSeparator}
+	copy(cached.buff, buff)
+	c.cache[id] = cached
 }
 
 func (c *ConcurrentWriter) writeCache() error {
 	for {
 		currentIndex := c.lastChunkWritten + 1
-		buff, set := c.cache[currentIndex]
+		cached, set := c.cache[currentIndex]
 		if !set {
 			return nil
 		}
 
-		if err := c.writeBuff(buff); err != nil {
+		if err := c.writeBuff(cached.buff, cached.endsInSeparator); err != nil {
 			return err
 		}
 
@@ -62,15 +182,15 @@ func (c *ConcurrentWriter) writeCache() error {
 	}
 }
 
-func (c *ConcurrentWriter) writeBuff(buff []byte) error {
+func (c *ConcurrentWriter) writeBuff(buff []byte, endsInSeparator bool) error {
 	if len(buff) == 0 {
 		return nil
 	}
 
 	if c.firstWrite {
 		c.firstWrite = false
-	} else {
-		if _, err := c.handle.Write([]byte{'\n'}); err != nil {
+	} else if !c.endsInSeparator {
+		if _, err := c.handle.Write(c.separator); err != nil {
 			return err
 		}
 	}
@@ -79,5 +199,6 @@ func (c *ConcurrentWriter) writeBuff(buff []byte) error {
 		return err
 	}
 
+	c.endsInSeparator = endsInSeparator
 	return nil
 }